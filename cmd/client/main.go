@@ -2,17 +2,24 @@
 // Labo 4 SDR
 
 // Package main est le point d'entrée du programme permettant de démarrer le client.
-// Le client a à disposition un fichier de configuration qui contient les adresses des serveurs.
+// Le client lit un fichier de configuration qui contient les adresses des serveurs.
+// Sans fichier spécifié, la configuration embarquée dans l'exécutable est utilisée.
+// Sans commande, le client lit les commandes de l'utilisateur en boucle. Avec une commande en argument, il l'exécute,
+// affiche son résultat et se termine avec un code de sortie indiquant si la commande a abouti.
 package main
 
 import (
 	_ "embed"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/Lazzzer/labo4-sdr/internal/client"
 	"github.com/Lazzzer/labo4-sdr/internal/shared"
 	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
 )
 
 //go:embed config.json
@@ -20,17 +27,47 @@ var config string
 
 // main est la méthode d'entrée du programme
 func main() {
-	if len(os.Args) != 1 {
-		log.Fatal("Usage: go run main.go")
+	configPath := flag.String("config", os.Getenv(shared.EnvConfig), "path of the configuration file, the embedded configuration is used if empty (env "+shared.EnvConfig+")")
+	output := flag.String("output", client.OutputTable, "format of the results: "+strings.Join(client.Outputs, ", "))
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: client [-config <path>] [-output table|json|csv]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       client [-config <path>] wave [-ask <server number>] [-stable] [text options] [-f <file> | <text>]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       client [-config <path>] probe [-root <server number>] [text options] [-f <file> | <text>]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       client [-config <path>] ask <server number> [computation id]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       client [-config <path>] ask-all [computation id]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       client [-config <path>] status [server number]")
+		fmt.Fprintln(flag.CommandLine.Output(), "Text options: -case-sensitive, -keep-diacritics, -keep-ligatures, -form <NFC|NFD|NFKC|NFKD>")
+		fmt.Fprintln(flag.CommandLine.Output(), "Without -f or text arguments, the text is read from the standard input when it is not a terminal.")
+		fmt.Fprintln(flag.CommandLine.Output(), "Exit codes: 0 complete result, 1 no result, 2 invalid command, 3 unreachable server, 4 partial result.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := client.ValidateOutput(*output); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		os.Exit(client.ExitUsage)
+	}
+
+	configuration, err := shared.LoadConfig[types.Config](*configPath, config)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	configuration, err := shared.Parse[types.Config](config)
+	network, err := transport.New(configuration.Transport, transport.Options{
+		FragmentSize:   configuration.FragmentSize,
+		MaxMessageSize: configuration.MaxMessageSize,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	cl := client.Client{
 		Servers: configuration.Servers,
+		Network: network,
+		Output:  *output,
+	}
+	if flag.NArg() != 0 {
+		os.Exit(cl.RunCommand(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
 	}
 	cl.Run()
 }
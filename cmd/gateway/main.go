@@ -0,0 +1,74 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package main est le point d'entrée du programme permettant de démarrer la passerelle HTTP devant le réseau de serveurs.
+// La passerelle lit le même fichier de configuration que les serveurs, afin de connaître leurs adresses, leurs caractères
+// et la liste d'adjacence du réseau. Sans fichier spécifié, la configuration embarquée dans l'exécutable est utilisée.
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/Lazzzer/labo4-sdr/internal/client"
+	"github.com/Lazzzer/labo4-sdr/internal/gateway"
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/topology"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
+)
+
+//go:embed config.json
+var config string
+
+const defaultHTTPAddress = "localhost:8000" // Adresse d'écoute HTTP par défaut
+
+// main est la méthode d'entrée du programme
+func main() {
+	configPath := flag.String("config", os.Getenv(shared.EnvConfig), "path of the server configuration file, the embedded configuration is used if empty (env "+shared.EnvConfig+")")
+	httpAddress := flag.String("http", os.Getenv(shared.EnvHTTP), "address of the HTTP listener, "+defaultHTTPAddress+" if empty (env "+shared.EnvHTTP+")")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: gateway [-config <path>] [-http <address>]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *httpAddress == "" {
+		*httpAddress = defaultHTTPAddress
+	}
+
+	configuration, err := shared.LoadConfig[types.ServerConfig](*configPath, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := topology.Check(configuration); err != nil {
+		log.Fatal(err)
+	}
+
+	network, err := transport.New(configuration.Transport, transport.Options{
+		FragmentSize:   configuration.FragmentSize,
+		MaxMessageSize: configuration.MaxMessageSize,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	servers := make(map[int]string)
+	for number, server := range configuration.Servers {
+		servers[number] = server.Address
+	}
+	cl := &client.Client{
+		Servers: servers,
+		Network: network,
+	}
+
+	shared.Log(types.INFO, shared.GREEN+"Gateway listening on http://"+*httpAddress+shared.RESET)
+	log.Fatal(http.ListenAndServe(*httpAddress, gateway.New(cl, configuration)))
+}
@@ -2,18 +2,26 @@
 // Labo 4 SDR
 
 // Package main est le point d'entrée du programme permettant de démarrer le serveur.
-// Le serveur a à disposition un fichier de configuration qui contient les adresses des serveurs ainsi que une liste d'adjacence représentant le graphe du réseau.
+// Le serveur lit un fichier de configuration qui contient les adresses des serveurs ainsi que une liste d'adjacence représentant le graphe du réseau.
+// Sans fichier spécifié, la configuration embarquée dans l'exécutable est utilisée.
+// La sous-commande "validate" vérifie la configuration sans démarrer de serveur. Un serveur démarré avec un membre à
+// contacter rejoint un réseau en cours d'exécution, et tout serveur quitte le réseau proprement lors d'un CTRL+C.
 package main
 
 import (
 	_ "embed"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
 	"github.com/Lazzzer/labo4-sdr/internal/server"
 	"github.com/Lazzzer/labo4-sdr/internal/shared"
 	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/topology"
 )
 
 //go:embed config.json
@@ -21,34 +29,105 @@ var config string
 
 // main est la méthode d'entrée du programme
 func main() {
+	configPath := flag.String("config", os.Getenv(shared.EnvConfig), "path of the configuration file, the embedded configuration is used if empty (env "+shared.EnvConfig+")")
+	listen := flag.String("listen", os.Getenv(shared.EnvListen), "address to listen on, the address of the server in the configuration is used if empty (env "+shared.EnvListen+")")
+	id := flag.String("id", os.Getenv(shared.EnvID), "server number, can also be given as the first argument (env "+shared.EnvID+")")
+	join := flag.String("join", os.Getenv(shared.EnvJoin), "number of a member to contact to join a running network (env "+shared.EnvJoin+")")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: server [-config <path>] [-listen <address>] [-join <server number>] [-id <server number> | <server number>]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       server [-config <path>] validate")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
-	if flag.Arg(0) == "" {
+
+	if flag.Arg(0) == "validate" {
+		os.Exit(validate(*configPath, flag.Args()[1:]))
+	}
+
+	if flag.Arg(0) != "" {
+		*id = flag.Arg(0)
+	}
+	if *id == "" {
 		log.Fatal("Invalid argument, usage: <server number>")
 	}
 
-	number, err := strconv.Atoi(flag.Arg(0))
+	number, err := strconv.Atoi(*id)
 	if err != nil {
 		log.Fatal("Invalid argument, usage: <server number>")
 	}
 
-	configuration, err := shared.Parse[types.ServerConfig](config)
+	configuration, err := shared.LoadConfig[types.ServerConfig](*configPath, config)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if key := os.Getenv(shared.EnvKey); key != "" {
+		configuration.Key = key
+	}
 
-	_, ok := configuration.Servers[number]
-	if !ok {
-		log.Fatal("Invalid server number")
+	var contact *int
+	if *join != "" {
+		value, err := strconv.Atoi(*join)
+		if err != nil {
+			log.Fatal("Invalid argument, usage: -join <server number>")
+		}
+		contact = &value
 	}
 
-	server := server.Server{
-		Number:      number,
-		NbProcesses: len(configuration.Servers),
-		Letter:      configuration.Servers[number].Letter,
-		Address:     configuration.Servers[number].Address,
-		Servers:     configuration.Servers,
+	server, err := server.NewServer(number, configuration, contact)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *listen != "" {
+		server.Address = *listen
 	}
 
-	server.Init(&configuration.AdjacencyList)
-	server.Run()
+	exitChan := make(chan os.Signal, 1)
+	signal.Notify(exitChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-exitChan
+		if err := server.Leave(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	if err := server.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// validate vérifie la configuration et affiche ses problèmes. La méthode retourne le code de sortie du programme,
+// 0 si la configuration est valide et 1 sinon.
+func validate(configPath string, args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", configPath, "path of the configuration file, the embedded configuration is used if empty (env "+shared.EnvConfig+")")
+	flags.Parse(args)
+
+	source := configPath
+	if source == "" {
+		source = "embedded configuration"
+	}
+
+	configuration, err := shared.LoadConfig[types.ServerConfig](configPath, config)
+	if err != nil {
+		fmt.Println(shared.RED + err.Error() + shared.RESET)
+		return 1
+	}
+
+	issues := topology.Validate(configuration)
+	valid := true
+	for _, issue := range issues {
+		color := shared.ORANGE
+		if issue.Severity == topology.Error {
+			color = shared.RED
+			valid = false
+		}
+		fmt.Println(color + issue.String() + shared.RESET)
+	}
+
+	if !valid {
+		fmt.Println(shared.RED + source + " is invalid" + shared.RESET)
+		return 1
+	}
+	fmt.Println(shared.GREEN + source + " is valid" + shared.RESET)
+	return 0
 }
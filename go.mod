@@ -1,3 +1,5 @@
 module github.com/Lazzzer/labo4-sdr
 
 go 1.19
+
+require golang.org/x/text v0.14.0
@@ -0,0 +1,388 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package client
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// Codes de sortie du client en mode non interactif.
+const (
+	ExitOK          = 0 // La commande a abouti et son résultat a été affiché
+	ExitNoResult    = 1 // Un serveur a répondu sans résultat, par exemple pour un traitement inconnu ou en cours
+	ExitUsage       = 2 // La commande ou ses arguments sont invalides
+	ExitUnreachable = 3 // Un serveur n'a pas répondu dans le délai imparti
+	ExitPartial     = 4 // Le résultat a été affiché mais il est partiel, des processus n'ayant pas répondu
+)
+
+// exitSeverity classe les codes de sortie du moins grave au plus grave, un résultat partiel étant moins grave qu'une
+// absence de résultat.
+var exitSeverity = map[int]int{ExitOK: 0, ExitPartial: 1, ExitNoResult: 2, ExitUsage: 3, ExitUnreachable: 4}
+
+const askInterval = 200 * time.Millisecond // Délai entre deux demandes du résultat d'un traitement ondulatoire
+
+// Subcommands liste les sous-commandes disponibles en mode non interactif.
+var Subcommands = []string{"wave", "probe", "ask", "ask-all", "status"}
+
+// RunCommand exécute une seule commande décrite par les arguments de la ligne de commande, affiche son résultat et
+// retourne le code de sortie du programme. Le texte des commandes wave et probe est lu dans les arguments, dans le
+// fichier donné avec -f ou sur l'entrée standard si elle n'est pas un terminal.
+func (c *Client) RunCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "missing command, expected one of: "+strings.Join(Subcommands, ", "))
+		return ExitUsage
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var run func() int
+	switch args[0] {
+	case string(types.WaveCount):
+		file, options := textFlags(flags)
+		askServer := flags.Int("ask", -1, "server asked for the result, the first server of the configuration if negative")
+		stable := flags.Bool("stable", false, "use the wave variant terminating on stability, without knowing the number of servers")
+		run = func() int {
+			text, err := readText(flags.Args(), *file, stdin)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return ExitUsage
+			}
+			algorithm := types.WaveCount
+			if *stable {
+				algorithm = types.WaveStableCount
+			}
+			return c.runWave(algorithm, text, *options, *askServer, stdout, stderr)
+		}
+	case string(types.ProbeCount):
+		file, options := textFlags(flags)
+		root := flags.Int("root", -1, "number of the root server, the elected leader if negative")
+		run = func() int {
+			text, err := readText(flags.Args(), *file, stdin)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return ExitUsage
+			}
+			return c.runProbe(text, *options, *root, stdout, stderr)
+		}
+	case string(types.Ask):
+		run = func() int {
+			if flags.NArg() != 1 && flags.NArg() != 2 {
+				fmt.Fprintln(stderr, "usage: ask <server number> [computation id]")
+				return ExitUsage
+			}
+			number, err := strconv.Atoi(flags.Arg(0))
+			if err != nil {
+				fmt.Fprintln(stderr, "invalid server number")
+				return ExitUsage
+			}
+			return c.runAsk([]int{number}, flags.Arg(1), stdout, stderr)
+		}
+	case "ask-all":
+		run = func() int {
+			if flags.NArg() > 1 {
+				fmt.Fprintln(stderr, "usage: ask-all [computation id]")
+				return ExitUsage
+			}
+			return c.runAsk(c.serverNumbers(), flags.Arg(0), stdout, stderr)
+		}
+	case string(types.Status):
+		run = func() int {
+			if flags.NArg() > 1 {
+				fmt.Fprintln(stderr, "usage: status [server number]")
+				return ExitUsage
+			}
+			numbers := c.serverNumbers()
+			if flags.NArg() == 1 {
+				number, err := strconv.Atoi(flags.Arg(0))
+				if err != nil {
+					fmt.Fprintln(stderr, "invalid server number")
+					return ExitUsage
+				}
+				numbers = []int{number}
+			}
+			return c.runStatus(numbers, stdout, stderr)
+		}
+	default:
+		fmt.Fprintln(stderr, "unknown command "+args[0]+", expected one of: "+strings.Join(Subcommands, ", "))
+		return ExitUsage
+	}
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return ExitUsage
+	}
+	return run()
+}
+
+// textFlags déclare les options communes aux commandes de traitement d'un texte : le fichier contenant le texte et
+// les options de normalisation.
+func textFlags(flags *flag.FlagSet) (*string, *types.TextOptions) {
+	options := &types.TextOptions{}
+	file := flags.String("f", "", "file containing the text to process, \"-\" reads the standard input")
+	flags.BoolVar(&options.CaseSensitive, "case-sensitive", false, "distinguish uppercase and lowercase characters")
+	flags.BoolVar(&options.KeepDiacritics, "keep-diacritics", false, "keep diacritics instead of removing them")
+	flags.BoolVar(&options.KeepLigatures, "keep-ligatures", false, "keep ligatures instead of expanding them")
+	flags.StringVar(&options.Form, "form", "", "Unicode normalization form (NFC, NFD, NFKC or NFKD)")
+	return file, options
+}
+
+// readText retourne le texte à traiter. Il est lu dans le fichier spécifié, dans les arguments restants, ou sur
+// l'entrée standard si aucun des deux n'est donné et qu'elle n'est pas un terminal.
+func readText(args []string, file string, stdin io.Reader) (string, error) {
+	if file != "" && len(args) > 0 {
+		return "", fmt.Errorf("the text must be given either as arguments or with -f, not both")
+	}
+
+	var content []byte
+	var err error
+	switch {
+	case file == "-":
+		content, err = io.ReadAll(stdin)
+	case file != "":
+		content, err = os.ReadFile(file)
+	case len(args) > 0:
+		return strings.Join(args, " "), nil
+	case isPiped(stdin):
+		content, err = io.ReadAll(stdin)
+	default:
+		return "", fmt.Errorf("no text to process, give it as arguments, with -f or on the standard input")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	text := strings.TrimRight(string(content), "\r\n")
+	if text == "" {
+		return "", fmt.Errorf("no text to process")
+	}
+	return text, nil
+}
+
+// isPiped indique si l'entrée spécifiée est un fichier ou un pipe plutôt qu'un terminal.
+func isPiped(stdin io.Reader) bool {
+	file, ok := stdin.(*os.File)
+	if !ok {
+		return stdin != nil
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// runWave envoie une commande de l'algorithme ondulatoire spécifié à tous les serveurs puis demande le résultat au
+// serveur spécifié jusqu'à la fin du traitement.
+func (c *Client) runWave(algorithm types.CommandType, text string, options types.TextOptions, askServer int, stdout io.Writer, stderr io.Writer) int {
+	if numbers := c.serverNumbers(); askServer < 0 && len(numbers) > 0 {
+		askServer = numbers[0]
+	}
+	address, ok := c.Servers[askServer]
+	if !ok {
+		fmt.Fprintln(stderr, "invalid server number")
+		return ExitUsage
+	}
+	if err := shared.ValidateTextOptions(options); err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+
+	command := types.Command{Type: algorithm, ID: shared.NewComputationID(), Text: text, Options: options}
+	data, err := json.Marshal(command)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+	for _, number := range c.serverNumbers() {
+		if _, err := c.exchange(string(data), c.Servers[number], 0); err != nil {
+			fmt.Fprintln(stderr, err)
+			return ExitUnreachable
+		}
+	}
+
+	// Le serveur ne connaît le traitement qu'après avoir reçu la commande, on redemande le résultat tant qu'il ne le connaît pas
+	ask, _ := json.Marshal(types.Command{Type: types.Ask, ID: command.ID})
+	deadline := time.Now().Add(responseTimeout)
+	for {
+		response, code := c.request(string(ask), address, stderr)
+		if code == ExitOK || code == ExitPartial {
+			return c.renderResponses(stdout, stderr, *response)
+		}
+		if code != ExitNoResult || time.Now().After(deadline) {
+			if response != nil {
+				fmt.Fprintln(stderr, response.Error)
+			}
+			return code
+		}
+		time.Sleep(askInterval)
+	}
+}
+
+// runProbe envoie une commande probe au serveur racine spécifié, ou au leader élu si le numéro est négatif, et affiche le résultat.
+func (c *Client) runProbe(text string, options types.TextOptions, root int, stdout io.Writer, stderr io.Writer) int {
+	if root < 0 {
+		leader, err := c.Leader()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return ExitUnreachable
+		}
+		root = leader
+	}
+	address, ok := c.Servers[root]
+	if !ok {
+		fmt.Fprintln(stderr, "invalid root server number")
+		return ExitUsage
+	}
+	if err := shared.ValidateTextOptions(options); err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+
+	data, err := json.Marshal(types.Command{Type: types.ProbeCount, ID: shared.NewComputationID(), Text: text, Options: options})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+	response, code := c.request(string(data), address, stderr)
+	if response == nil {
+		return code
+	}
+	return c.renderResponses(stdout, stderr, *response)
+}
+
+// runAsk demande le résultat d'un traitement à chacun des serveurs spécifiés et affiche leurs réponses. Le code de sortie
+// est le plus grave rencontré parmi les serveurs.
+func (c *Client) runAsk(numbers []int, id string, stdout io.Writer, stderr io.Writer) int {
+	data, err := json.Marshal(types.Command{Type: types.Ask, ID: id})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+
+	code := ExitOK
+	var responses []types.Response
+	for _, number := range numbers {
+		address, ok := c.Servers[number]
+		if !ok {
+			fmt.Fprintln(stderr, "invalid server number")
+			return ExitUsage
+		}
+		response, serverCode := c.request(string(data), address, stderr)
+		if response != nil {
+			responses = append(responses, *response)
+		}
+		code = worse(code, serverCode)
+	}
+
+	if len(responses) > 0 {
+		code = worse(code, c.renderResponses(stdout, stderr, responses...))
+	}
+	return code
+}
+
+// runStatus demande l'état de leurs voisins à chacun des serveurs spécifiés et affiche leurs réponses. Les serveurs qui
+// ne répondent pas sont signalés sur la sortie d'erreur et le code de sortie est alors ExitUnreachable.
+func (c *Client) runStatus(numbers []int, stdout io.Writer, stderr io.Writer) int {
+	data, err := json.Marshal(types.Command{Type: types.Status})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+
+	code := ExitOK
+	var responses []types.Response
+	for _, number := range numbers {
+		address, ok := c.Servers[number]
+		if !ok {
+			fmt.Fprintln(stderr, "invalid server number")
+			return ExitUsage
+		}
+		response, err := c.exchange(string(data), address, leaderQueryTimeout)
+		if err == nil {
+			var parsed *types.Response
+			if parsed, err = parseResponse(response); err == nil {
+				responses = append(responses, *parsed)
+				continue
+			}
+		}
+		fmt.Fprintln(stderr, err)
+		code = ExitUnreachable
+	}
+
+	if len(responses) > 0 {
+		if err := c.renderStatus(stdout, responses...); err != nil {
+			fmt.Fprintln(stderr, err)
+			return ExitUnreachable
+		}
+	}
+	return code
+}
+
+// request envoie une commande au serveur spécifié et retourne sa réponse avec le code de sortie correspondant :
+// ExitOK si la réponse contient un résultat complet, ExitPartial si son résultat est partiel, ExitNoResult si elle
+// contient une erreur et ExitUnreachable si le serveur n'a pas répondu correctement. Dans ce dernier cas, la réponse est nil et l'erreur est affichée.
+func (c *Client) request(command string, address string, stderr io.Writer) (*types.Response, int) {
+	data, err := c.exchange(command, address, responseTimeout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, ExitUnreachable
+	}
+	response, err := parseResponse(data)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, ExitUnreachable
+	}
+	if response.Result == nil {
+		return response, ExitNoResult
+	}
+	if response.Result.Partial {
+		return response, ExitPartial
+	}
+	return response, ExitOK
+}
+
+// renderResponses affiche les réponses et retourne ExitNoResult si l'une d'elles ne contient pas de résultat, ou
+// ExitPartial si l'un des résultats est partiel.
+func (c *Client) renderResponses(stdout io.Writer, stderr io.Writer, responses ...types.Response) int {
+	if err := c.render(stdout, stderr, responses...); err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUnreachable
+	}
+	code := ExitOK
+	for _, response := range responses {
+		switch {
+		case response.Result == nil:
+			return ExitNoResult
+		case response.Result.Partial:
+			code = ExitPartial
+		}
+	}
+	return code
+}
+
+// worse retourne le plus grave des deux codes de sortie spécifiés.
+func worse(a int, b int) int {
+	if exitSeverity[b] > exitSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// serverNumbers retourne les numéros des serveurs du réseau triés par ordre croissant.
+func (c *Client) serverNumbers() []int {
+	numbers := make([]int, 0, len(c.Servers))
+	for number := range c.Servers {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
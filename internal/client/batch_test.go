@@ -0,0 +1,68 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
+)
+
+// fakeServers démarre sur un réseau en mémoire un faux serveur par réponse spécifiée, répondant toujours la même chose
+// à toute commande, et retourne un client de ce réseau.
+func fakeServers(t *testing.T, responses ...types.Response) *Client {
+	t.Helper()
+	network := transport.NewMemoryNetwork()
+	c := &Client{Servers: make(map[int]string), Network: network, Output: OutputJSON}
+	for i, response := range responses {
+		response.Server = i
+		data, err := json.Marshal(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, err := network.Listen(fmt.Sprintf("server-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { server.Close() })
+		go func() {
+			for packet := range server.Receive() {
+				server.Send(packet.From, data)
+			}
+		}()
+		c.Servers[i] = server.Address()
+	}
+	return c
+}
+
+// TestRunAskExitCode vérifie le code de sortie de la commande ask-all selon les réponses des serveurs.
+func TestRunAskExitCode(t *testing.T) {
+	complete := types.Response{Result: &types.Result{ID: "a", Counts: map[string]int{"A": 1}}}
+	partial := types.Response{Result: &types.Result{ID: "a", Counts: map[string]int{"A": 1}, Partial: true, Unresponsive: []int{2}}}
+	unknown := types.Response{Error: "unknown computation"}
+
+	tests := []struct {
+		name      string
+		responses []types.Response
+		code      int
+	}{
+		{"complete results", []types.Response{complete, complete}, ExitOK},
+		{"partial result", []types.Response{complete, partial}, ExitPartial},
+		{"partial result and no result", []types.Response{partial, unknown}, ExitNoResult},
+		{"no result and partial result", []types.Response{unknown, partial}, ExitNoResult},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := fakeServers(t, test.responses...)
+			if code := c.RunCommand([]string{"ask-all", "a"}, nil, io.Discard, io.Discard); code != test.code {
+				t.Fatalf("exit code %d, want %d", code, test.code)
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 // Auteurs: Jonathan Friedli, Lazar Pavicevic
 // Labo 4 SDR
 
-// Package client propose un client UDP envoyant des commandes sous forme de string json à des serveurs du réseau.
+// Package client propose un client envoyant des commandes sous forme de string json à des serveurs du réseau.
 //
 // Le client parse l'entrée de l'utilisateur et envoie la commande correspondante au serveur.
 package client
@@ -9,24 +9,35 @@ package client
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"net"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Lazzzer/labo4-sdr/internal/shared"
 	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
 )
 
-// Client représente un client UDP connecté à un réseau de serveurs capable d'envoyer des commandes de traitement de texte.
+// Client représente un client connecté à un réseau de serveurs capable d'envoyer des commandes de traitement de texte.
 type Client struct {
-	Servers map[int]string // Map des serveurs du réseau, avec comme clé le numéro du serveur et comme valeur l'adresse du serveur
+	Servers map[int]string    // Map des serveurs du réseau, avec comme clé le numéro du serveur et comme valeur l'adresse du serveur
+	Network transport.Network // Réseau utilisé pour créer un transport à chaque commande envoyée
+	Output  string            // Format d'affichage des réponses des serveurs (table, json ou csv), table si vide
 }
 
+const (
+	responseTimeout    = time.Minute     // Délai d'attente maximal de la réponse d'un serveur
+	leaderQueryTimeout = 2 * time.Second // Délai d'attente maximal de la réponse d'un serveur aux commandes leader et status
+)
+
+// ErrUnreachable est l'erreur retournée lorsqu'un serveur ne répond pas à une commande dans le délai imparti.
+var ErrUnreachable = errors.New("server is unreachable")
+
 var exitChan = make(chan os.Signal, 1) // Chan qui gère le CTRL+C
 
 // Run est la méthode principale du client. Elle gère l'entrée de l'utilisateur et envoie les commandes aux serveurs.
@@ -80,38 +91,59 @@ func (c *Client) processInput(input string) (bool, string, []string, error) {
 	waitResponse := false
 
 	switch args[0] {
-	case string(types.WaveCount):
-
-		if length < 2 {
+	case string(types.WaveCount), string(types.WaveStableCount):
+		options, text, err := parseTextOptions(args[1:])
+		if err != nil {
+			return false, "", nil, err
+		}
+		if len(text) == 0 {
 			return false, "", nil, fmt.Errorf("invalid wave command")
 		}
 
-		command.Text = strings.Join(args[1:], " ")
+		command.Text = strings.Join(text, " ")
+		command.Options = options
 
-		command.Type = types.WaveCount
+		command.Type = types.CommandType(args[0])
+		command.ID = shared.NewComputationID()
 		for _, address := range c.Servers {
 			addresses = append(addresses, address)
 		}
 	case string(types.ProbeCount):
-		if length < 3 {
+		if length < 2 {
 			return false, "", nil, fmt.Errorf("invalid probe command")
 		}
 
+		// Le premier argument est le numéro du serveur racine s'il correspond à un serveur et doit alors être suivi du
+		// texte, sinon le leader est la racine
 		value, err := strconv.Atoi(args[1])
+		if _, ok := c.Servers[value]; err == nil && ok {
+			if length == 2 {
+				return false, "", nil, fmt.Errorf("missing text for probe on server %d", value)
+			}
+			args = args[1:]
+		} else if value, err = c.Leader(); err != nil {
+			return false, "", nil, err
+		} else {
+			fmt.Println(shared.CYAN + "\nUsing leader P" + strconv.Itoa(value) + " as root" + shared.RESET)
+		}
+
+		options, text, err := parseTextOptions(args[1:])
 		if err != nil {
-			return false, "", nil, fmt.Errorf("invalid server number")
+			return false, "", nil, err
 		}
-		if _, ok := c.Servers[value]; !ok {
-			return false, "", nil, fmt.Errorf("invalid server number")
+		if len(text) == 0 {
+			return false, "", nil, fmt.Errorf("invalid probe command")
 		}
 
-		command.Text = strings.Join(args[2:], " ")
+		command.Text = strings.Join(text, " ")
+		command.Options = options
 
 		command.Type = types.ProbeCount
+		command.ID = shared.NewComputationID()
 		addresses = append(addresses, c.Servers[value])
 		waitResponse = true
 	case string(types.Ask):
-		if length != 2 {
+		if length != 2 && length != 3 {
 			return false, "", nil, fmt.Errorf("invalid ask command")
 		}
 		value, err := strconv.Atoi(args[1])
@@ -124,6 +156,24 @@ func (c *Client) processInput(input string) (bool, string, []string, error) {
 
 		command.Type = types.Ask
 		command.Text = ""
+		if length == 3 {
+			command.ID = args[2]
+		}
+		addresses = append(addresses, c.Servers[value])
+		waitResponse = true
+	case string(types.Status):
+		if length != 2 {
+			return false, "", nil, fmt.Errorf("invalid status command")
+		}
+		value, err := strconv.Atoi(args[1])
+		if err != nil {
+			return false, "", nil, fmt.Errorf("invalid server number")
+		}
+		if _, ok := c.Servers[value]; !ok {
+			return false, "", nil, fmt.Errorf("invalid server number")
+		}
+
+		command.Type = types.Status
 		addresses = append(addresses, c.Servers[value])
 		waitResponse = true
 	case string(types.Quit):
@@ -133,6 +183,10 @@ func (c *Client) processInput(input string) (bool, string, []string, error) {
 		return false, "", nil, fmt.Errorf("unknown command")
 	}
 
+	if command.Type != types.Ask && command.Type != types.Status {
+		fmt.Println(shared.CYAN + "\nComputation ID: " + command.ID + shared.RESET)
+	}
+
 	if jsonCommand, err := json.Marshal(command); err == nil {
 		return waitResponse, string(jsonCommand), addresses, nil
 	} else {
@@ -140,50 +194,148 @@ func (c *Client) processInput(input string) (bool, string, []string, error) {
 	}
 }
 
-// sendCommand envoie une commande au serveur spécifié. Elle s'occupe de la connexion UDP et de la fermeture de celle-ci.
+// parseTextOptions lit les options de normalisation placées avant le texte d'une commande et retourne les options
+// ainsi que les mots du texte. Les options reconnues sont --case-sensitive, --keep-diacritics, --keep-ligatures et
+// --form=<NFC|NFD|NFKC|NFKD>. Le texte commence au premier mot qui n'est pas une option.
+func parseTextOptions(args []string) (types.TextOptions, []string, error) {
+	var options types.TextOptions
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		switch option := args[0]; {
+		case option == "--":
+			return options, args[1:], nil
+		case option == "--case-sensitive":
+			options.CaseSensitive = true
+		case option == "--keep-diacritics":
+			options.KeepDiacritics = true
+		case option == "--keep-ligatures":
+			options.KeepLigatures = true
+		case strings.HasPrefix(option, "--form="):
+			options.Form = strings.ToUpper(strings.TrimPrefix(option, "--form="))
+		default:
+			return options, nil, fmt.Errorf("unknown option %s", option)
+		}
+		args = args[1:]
+	}
+
+	if err := shared.ValidateTextOptions(options); err != nil {
+		return options, nil, err
+	}
+	return options, args, nil
+}
+
+// sendCommand envoie une commande au serveur spécifié et affiche sa réponse si elle est attendue.
 func (c *Client) sendCommand(command string, address string, waitResponse bool) {
-	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	timeout := time.Duration(0)
+	if waitResponse {
+		timeout = responseTimeout
+	}
+	data, err := c.exchange(command, address, timeout)
+	if err == nil && waitResponse {
+		var response *types.Response
+		if response, err = parseResponse(data); err == nil {
+			fmt.Println()
+			err = c.render(os.Stdout, os.Stdout, *response)
+		}
+	}
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println(shared.RED + "\nERROR: " + err.Error() + shared.RESET)
 	}
+}
 
-	connection, err := net.DialUDP("udp", nil, udpAddr)
+// Send envoie une commande au serveur spécifié et retourne sa réponse si elle est attendue, ou nil sinon.
+// Elle permet à d'autres programmes, comme la passerelle HTTP, d'utiliser le client sans passer par son interface.
+func (c *Client) Send(command types.Command, number int, waitResponse bool) (*types.Response, error) {
+	address, ok := c.Servers[number]
+	if !ok {
+		return nil, fmt.Errorf("invalid server number %d", number)
+	}
+	data, err := json.Marshal(command)
 	if err != nil {
-		shared.Log(types.ERROR, err.Error())
-		return
+		return nil, err
 	}
-	defer func(connection *net.UDPConn) {
-		err := connection.Close()
-		if err != nil {
-			shared.Log(types.ERROR, err.Error())
-		}
-	}(connection)
+	timeout := time.Duration(0)
+	if waitResponse {
+		timeout = responseTimeout
+	}
+	response, err := c.exchange(string(data), address, timeout)
+	if err != nil || !waitResponse {
+		return nil, err
+	}
+	return parseResponse(response)
+}
 
-	_, err = connection.Write([]byte(command + "\n"))
+// Leader retourne le numéro du leader élu du réseau. Les serveurs sont interrogés dans l'ordre jusqu'à ce que l'un d'eux
+// connaisse le leader.
+func (c *Client) Leader() (int, error) {
+	data, err := json.Marshal(types.Command{Type: types.Leader})
 	if err != nil {
-		shared.Log(types.ERROR, err.Error())
-		return
+		return 0, err
 	}
 
-	if waitResponse {
-		buffer := make([]byte, 1024)
-		n, servAddr, err := connection.ReadFromUDP(buffer)
+	err = fmt.Errorf("no server in the configuration")
+	for _, number := range c.serverNumbers() {
+		var response string
+		response, err = c.exchange(string(data), c.Servers[number], leaderQueryTimeout)
+		if err != nil {
+			continue
+		}
+		var parsed *types.Response
+		parsed, err = parseResponse(response)
+		if err != nil {
+			continue
+		}
+		if parsed.Leader != nil {
+			return *parsed.Leader, nil
+		}
+		err = errors.New(parsed.Error)
+	}
+	return 0, fmt.Errorf("cannot find the leader: %w", err)
+}
 
+// exchange envoie une commande au serveur spécifié et attend sa réponse pendant le délai spécifié, ou n'attend pas de
+// réponse si le délai est nul. Elle s'occupe de la création du transport et de la fermeture de celui-ci. Le transport se
+// charge de découper les messages trop grands, ce qui permet d'envoyer des textes plus grands qu'un datagramme.
+// Une erreur ErrUnreachable est retournée si le serveur ne répond pas à temps.
+func (c *Client) exchange(command string, address string, timeout time.Duration) (string, error) {
+	t, err := c.Network.Listen("")
+	if err != nil {
+		return "", err
+	}
+	defer func(t transport.Transport) {
+		err := t.Close()
 		if err != nil {
-			fmt.Println(shared.RED + "\nServer @" + udpAddr.String() + " is unreachable" + shared.RESET)
-			return
+			shared.Log(types.ERROR, err.Error())
 		}
+	}(t)
+
+	err = t.Send(address, []byte(command+"\n"))
+	if err != nil {
+		return "", err
+	}
+	if timeout == 0 {
+		return "", nil
+	}
 
-		fmt.Println(shared.GREEN + "\nFrom Server @" + servAddr.String() + "\n" + shared.RESET + string(buffer[0:n]))
+	select {
+	case packet, ok := <-t.Receive():
+		if !ok {
+			return "", fmt.Errorf("server @%s: %w", address, ErrUnreachable)
+		}
+		return string(packet.Data), nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("server @%s: %w", address, ErrUnreachable)
 	}
 }
 
 // displayPrompt affiche les commandes disponibles pour l'utilisateur.
 func displayPrompt() {
 	fmt.Println("\nAvailable commands:")
-	fmt.Println(shared.YELLOW + " - wave <text>")
-	fmt.Println(" - probe <server number> <text>")
-	fmt.Println(" - ask <server number>")
-	fmt.Println(" - quit" + shared.RESET)
+	fmt.Println(shared.YELLOW + " - wave [options] <text>")
+	fmt.Println(" - wave-stable [options] <text>")
+	fmt.Println(" - probe [server number] [options] <text>")
+	fmt.Println(" - ask <server number> [computation id]")
+	fmt.Println(" - status <server number>")
+	fmt.Println(" - quit")
+	fmt.Println("Options: --case-sensitive, --keep-diacritics, --keep-ligatures, --form=<NFC|NFD|NFKC|NFKD>" + shared.RESET)
 	fmt.Println(shared.BOLD + "\nEnter a command to send:" + shared.RESET)
 }
@@ -0,0 +1,54 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// TestProcessInputProbe vérifie la lecture du serveur racine et du texte d'une commande probe.
+func TestProcessInputProbe(t *testing.T) {
+	c := &Client{Servers: map[int]string{0: "server-0", 2: "server-2"}}
+
+	tests := []struct {
+		name      string
+		input     string
+		text      string
+		addresses []string
+		err       string
+	}{
+		{"root and text", "probe 2 la pomme", "la pomme", []string{"server-2"}, ""},
+		{"root and number as text", "probe 0 2", "2", []string{"server-0"}, ""},
+		{"root without text", "probe 2", "", nil, "missing text for probe on server 2"},
+		{"root with options only", "probe 2 --case-sensitive", "", nil, "invalid probe command"},
+		{"no argument", "probe", "", nil, "invalid probe command"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wait, data, addresses, err := c.processInput(test.input)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var command types.Command
+			if err := json.Unmarshal([]byte(data), &command); err != nil {
+				t.Fatal(err)
+			}
+			if !wait || command.Type != types.ProbeCount || command.Text != test.text || !reflect.DeepEqual(addresses, test.addresses) {
+				t.Fatalf("command %s to %v, want the text %q to %v", data, addresses, test.text, test.addresses)
+			}
+		})
+	}
+}
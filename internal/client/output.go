@@ -0,0 +1,237 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// Formats d'affichage des réponses des serveurs.
+const (
+	OutputTable = "table" // Tableau lisible et coloré, format par défaut
+	OutputJSON  = "json"  // Objet JSON, ou tableau JSON pour plusieurs réponses
+	OutputCSV   = "csv"   // Une ligne par caractère compté, précédée d'une ligne d'en-tête
+)
+
+// Outputs liste les formats d'affichage disponibles.
+var Outputs = []string{OutputTable, OutputJSON, OutputCSV}
+
+// ValidateOutput vérifie que le format d'affichage est connu. Un format vide correspond au tableau.
+func ValidateOutput(output string) error {
+	switch output {
+	case "", OutputTable, OutputJSON, OutputCSV:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected one of: %s", output, strings.Join(Outputs, ", "))
+}
+
+// parseResponse parse la réponse JSON d'un serveur.
+func parseResponse(data string) (*types.Response, error) {
+	response, err := shared.Parse[types.Response](data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response from server: %w", err)
+	}
+	if response.Result == nil && response.Leader == nil && response.Neighbors == nil && response.Error == "" {
+		return nil, fmt.Errorf("invalid response from server: no result nor error")
+	}
+	return response, nil
+}
+
+// render affiche les réponses des serveurs dans le format du client. Les erreurs des réponses sont affichées sur la
+// sortie d'erreur pour les formats JSON et CSV, afin de ne pas mélanger les résultats et les erreurs.
+func (c *Client) render(stdout io.Writer, stderr io.Writer, responses ...types.Response) error {
+	if len(responses) > 0 && responses[0].Neighbors != nil {
+		return c.renderStatus(stdout, responses...)
+	}
+
+	switch c.Output {
+	case OutputJSON:
+		var value any = responses
+		if len(responses) == 1 {
+			value = responses[0]
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case OutputCSV:
+		writer := csv.NewWriter(stdout)
+		writer.Write([]string{"server", "id", "algorithm", "root", "partial", "character", "count"})
+		for _, response := range responses {
+			if response.Result == nil {
+				fmt.Fprintln(stderr, "P"+strconv.Itoa(response.Server)+": "+response.Error)
+				continue
+			}
+			result := response.Result
+			root := ""
+			if result.Root != nil {
+				root = strconv.Itoa(*result.Root)
+			}
+			for _, character := range sortedCharacters(result.Counts) {
+				writer.Write([]string{
+					strconv.Itoa(response.Server),
+					result.ID,
+					string(result.Algorithm),
+					root,
+					strconv.FormatBool(result.Partial),
+					character,
+					strconv.Itoa(result.Counts[character]),
+				})
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		for _, response := range responses {
+			fmt.Fprintln(stdout, formatTable(response))
+		}
+		return nil
+	}
+}
+
+// renderStatus affiche l'état des voisins des serveurs, tel que retourné par la commande status, dans le format du client.
+func (c *Client) renderStatus(stdout io.Writer, responses ...types.Response) error {
+	switch c.Output {
+	case OutputJSON:
+		var value any = responses
+		if len(responses) == 1 {
+			value = responses[0]
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case OutputCSV:
+		writer := csv.NewWriter(stdout)
+		writer.Write([]string{"server", "leader", "neighbor", "address", "state", "last_seen_ms"})
+		for _, response := range responses {
+			leader := ""
+			if response.Leader != nil {
+				leader = strconv.Itoa(*response.Leader)
+			}
+			for _, neighbor := range response.Neighbors {
+				writer.Write([]string{
+					strconv.Itoa(response.Server),
+					leader,
+					strconv.Itoa(neighbor.Number),
+					neighbor.Address,
+					string(neighbor.State),
+					strconv.FormatInt(neighbor.LastSeenMs, 10),
+				})
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		for _, response := range responses {
+			fmt.Fprintln(stdout, formatStatus(response))
+		}
+		return nil
+	}
+}
+
+// formatStatus retourne une chaîne de caractères lisible contenant le leader connu du serveur et l'état de ses voisins.
+func formatStatus(response types.Response) string {
+	result := shared.GREEN + "From Server P" + strconv.Itoa(response.Server) + shared.RESET + "\n"
+	result += "---------------------\n"
+	if response.Leader != nil {
+		result += "Leader: P" + strconv.Itoa(*response.Leader) + "\n"
+	} else {
+		result += "Leader: unknown\n"
+	}
+	for _, neighbor := range response.Neighbors {
+		color := shared.GREEN
+		if neighbor.State == types.Suspected {
+			color = shared.RED
+		}
+		result += color + "P" + strconv.Itoa(neighbor.Number) + " (" + neighbor.Address + ") : " + string(neighbor.State) + shared.RESET
+		result += ", last message " + strconv.FormatInt(neighbor.LastSeenMs, 10) + " ms ago\n"
+	}
+	result += "---------------------"
+	return result
+}
+
+// formatTable retourne une chaîne de caractères lisible contenant le nombre d'occurrences de chaque caractère du texte
+// traité par les serveurs du réseau, ou l'erreur de la réponse.
+func formatTable(response types.Response) string {
+	header := shared.GREEN + "From Server P" + strconv.Itoa(response.Server) + shared.RESET + "\n"
+	if response.Result == nil {
+		return header + shared.RED + response.Error + shared.RESET
+	}
+	r := response.Result
+
+	result := header
+	result += "---------------------\n"
+	result += "Computation ID: " + r.ID + "\n"
+	result += "Algorithm: " + string(r.Algorithm)
+	if r.Root != nil {
+		result += " (root P" + strconv.Itoa(*r.Root) + ")"
+	}
+	if r.CachedTree {
+		result += " along the cached spanning tree"
+	}
+	result += ", " + strconv.FormatInt(r.DurationMs, 10) + " ms\n"
+	result += "Servers in this network can process the following characters: "
+	numbers := make([]int, 0, len(r.Coverage))
+	for number := range r.Coverage {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		result += "[" + r.Coverage[number] + "] "
+	}
+
+	result += "\nOccurrences of processable characters in \"" + r.Text + "\" :\n"
+	for _, character := range sortedCharacters(r.Counts) {
+		result += shared.GREEN + character + " : " + strconv.Itoa(r.Counts[character]) + "\n" + shared.RESET
+	}
+	if len(r.Counts) == 0 {
+		result += shared.RED + "\nNo occurrence found\n\n" + shared.RESET
+	}
+	for _, conflict := range r.Conflicts {
+		numbers := make([]int, 0, len(conflict.Counts))
+		for number := range conflict.Counts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		counts := make([]string, len(numbers))
+		for i, number := range numbers {
+			counts[i] = "P" + strconv.Itoa(number) + "=" + strconv.Itoa(conflict.Counts[number])
+		}
+		result += shared.ORANGE + "Inconsistent counts for " + conflict.Character + ": " + strings.Join(counts, ", ") + ", retained " + strconv.Itoa(conflict.Retained) + "\n" + shared.RESET
+	}
+	if r.Partial {
+		names := make([]string, len(r.Unresponsive))
+		for i, number := range r.Unresponsive {
+			names[i] = "P" + strconv.Itoa(number)
+		}
+		result += shared.ORANGE + "Partial result, unresponsive: " + strings.Join(names, ", ") + "\n" + shared.RESET
+		if len(r.Missing) > 0 {
+			names = make([]string, len(r.Missing))
+			for i, number := range r.Missing {
+				names[i] = "P" + strconv.Itoa(number)
+			}
+			result += shared.ORANGE + "Missing counts from: " + strings.Join(names, ", ") + "\n" + shared.RESET
+		}
+	}
+	result += "---------------------"
+	return result
+}
+
+// sortedCharacters retourne les caractères comptés triés par ordre croissant.
+func sortedCharacters(counts map[string]int) []string {
+	characters := make([]string, 0, len(counts))
+	for character := range counts {
+		characters = append(characters, character)
+	}
+	sort.Strings(characters)
+	return characters
+}
@@ -0,0 +1,290 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// binaryTag est le premier octet de tout message encodé avec le codec binaire. Il ne peut pas commencer un message JSON.
+const binaryTag = 0x01
+
+// fieldsCache mémorise les indices des champs encodés de chaque type de structure.
+var fieldsCache sync.Map
+
+// errTruncated est l'erreur retournée lorsque les octets s'arrêtent au milieu d'une valeur.
+var errTruncated = errors.New("binary: truncated data")
+
+// binaryCodec encode les messages dans un format binaire compact.
+//
+// Les champs exportés d'une structure sont encodés dans leur ordre de déclaration, sans leur nom : l'émetteur et le
+// destinataire doivent donc utiliser la même version des types, ce que garantit la version du protocole. Les entiers
+// sont encodés en varint, les chaînes et les slices sont préfixées par leur longueur, les maps par leur nombre
+// d'entrées triées par clé, et les pointeurs par un octet indiquant s'ils sont nil. Les champs ignorés par JSON le
+// sont aussi.
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string {
+	return KindBinary
+}
+
+func (binaryCodec) Marshal(v any) ([]byte, error) {
+	return appendValue([]byte{binaryTag}, reflect.ValueOf(v))
+}
+
+func (binaryCodec) Unmarshal(data []byte, v any) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("binary: cannot decode into %T", v)
+	}
+	if len(data) == 0 || data[0] != binaryTag {
+		return fmt.Errorf("binary: missing tag")
+	}
+	r := &reader{data: data[1:]}
+	if err := r.readValue(target.Elem()); err != nil {
+		return err
+	}
+	if len(r.data) != 0 {
+		return fmt.Errorf("binary: %d unexpected trailing byte(s)", len(r.data))
+	}
+	return nil
+}
+
+// appendValue ajoute l'encodage de la valeur aux octets.
+func appendValue(buffer []byte, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buffer, 1), nil
+		}
+		return append(buffer, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(buffer, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.AppendUvarint(buffer, v.Uint()), nil
+	case reflect.String:
+		buffer = binary.AppendUvarint(buffer, uint64(v.Len()))
+		return append(buffer, v.String()...), nil
+	case reflect.Slice:
+		buffer = binary.AppendUvarint(buffer, uint64(v.Len()))
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(buffer, v.Bytes()...), nil
+		}
+		var err error
+		for i := 0; i < v.Len() && err == nil; i++ {
+			buffer, err = appendValue(buffer, v.Index(i))
+		}
+		return buffer, err
+	case reflect.Map:
+		buffer = binary.AppendUvarint(buffer, uint64(v.Len()))
+		keys := v.MapKeys()
+		sortKeys(keys)
+		var err error
+		for _, key := range keys {
+			if buffer, err = appendValue(buffer, key); err != nil {
+				return buffer, err
+			}
+			if buffer, err = appendValue(buffer, v.MapIndex(key)); err != nil {
+				return buffer, err
+			}
+		}
+		return buffer, nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(buffer, 0), nil
+		}
+		return appendValue(append(buffer, 1), v.Elem())
+	case reflect.Struct:
+		var err error
+		for _, i := range encodedFields(v.Type()) {
+			if buffer, err = appendValue(buffer, v.Field(i)); err != nil {
+				return buffer, err
+			}
+		}
+		return buffer, nil
+	default:
+		return buffer, fmt.Errorf("binary: unsupported type %s", v.Type())
+	}
+}
+
+// reader lit les valeurs encodées avec le codec binaire.
+type reader struct {
+	data []byte // Octets restant à lire
+}
+
+// readValue décode la valeur suivante dans la valeur spécifiée, qui doit être modifiable.
+func (r *reader) readValue(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := r.readByte()
+		v.SetBool(b == 1)
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, size := binary.Varint(r.data)
+		if size <= 0 {
+			return errTruncated
+		}
+		r.data = r.data[size:]
+		if v.OverflowInt(n) {
+			return fmt.Errorf("binary: value %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := r.readUvarint()
+		if err == nil && v.OverflowUint(n) {
+			err = fmt.Errorf("binary: value %d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+		return err
+	case reflect.String:
+		data, err := r.readBytes()
+		v.SetString(string(data))
+		return err
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data, err := r.readBytes()
+			if err == nil && data != nil {
+				v.SetBytes(append([]byte(nil), data...))
+			}
+			return err
+		}
+		n, err := r.readLength()
+		if err != nil || n == 0 {
+			return err
+		}
+		slice := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := r.readValue(slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Map:
+		n, err := r.readLength()
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		key := reflect.New(v.Type().Key()).Elem()
+		value := reflect.New(v.Type().Elem()).Elem()
+		for i := 0; i < n; i++ {
+			key.SetZero()
+			value.SetZero()
+			if err := r.readValue(key); err != nil {
+				return err
+			}
+			if err := r.readValue(value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Pointer:
+		present, err := r.readByte()
+		if err != nil || present == 0 {
+			return err
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := r.readValue(elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Struct:
+		for _, i := range encodedFields(v.Type()) {
+			if err := r.readValue(v.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("binary: unsupported type %s", v.Type())
+	}
+}
+
+// readByte lit un octet.
+func (r *reader) readByte() (byte, error) {
+	if len(r.data) == 0 {
+		return 0, errTruncated
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b, nil
+}
+
+// readUvarint lit un entier non signé encodé en varint.
+func (r *reader) readUvarint() (uint64, error) {
+	n, size := binary.Uvarint(r.data)
+	if size <= 0 {
+		return 0, errTruncated
+	}
+	r.data = r.data[size:]
+	return n, nil
+}
+
+// readLength lit un nombre d'éléments. Chaque élément occupant au moins un octet, un nombre plus grand que les octets
+// restants est refusé, ce qui évite d'allouer une slice ou une map démesurée pour un message invalide.
+func (r *reader) readLength() (int, error) {
+	n, err := r.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(r.data)) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+// readBytes lit une suite d'octets préfixée par sa longueur. Les octets retournés font partie des données lues.
+func (r *reader) readBytes() ([]byte, error) {
+	n, err := r.readLength()
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	data := r.data[:n]
+	r.data = r.data[n:]
+	return data, nil
+}
+
+// encodedFields retourne les indices des champs encodés de la structure : ses champs exportés qui ne sont pas
+// ignorés par JSON.
+func encodedFields(t reflect.Type) []int {
+	if fields, ok := fieldsCache.Load(t); ok {
+		return fields.([]int)
+	}
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.IsExported() && field.Tag.Get("json") != "-" {
+			fields = append(fields, i)
+		}
+	}
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+// sortKeys trie les clés d'une map, ce qui rend l'encodage d'une même map toujours identique.
+func sortKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return a.Uint() < b.Uint()
+		case reflect.String:
+			return a.String() < b.String()
+		default:
+			return false
+		}
+	})
+}
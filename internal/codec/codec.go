@@ -0,0 +1,80 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package codec propose l'encodage des messages échangés entre serveurs.
+// Un codec transforme un message en octets et inversement. Le package fournit un codec JSON, lisible et compris par
+// toutes les versions du serveur, et un codec binaire compact. Chaque message encodé permet de retrouver le codec
+// utilisé, ce qui permet à un serveur de recevoir des messages des deux codecs en même temps.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec représente un encodage des messages entre serveurs.
+type Codec interface {
+	Name() string                       // Retourne le nom du codec, utilisé dans la configuration et lors de la négociation
+	Marshal(v any) ([]byte, error)      // Encode la valeur spécifiée
+	Unmarshal(data []byte, v any) error // Décode les octets dans la valeur pointée par v
+}
+
+const (
+	KindJSON   = "json"   // Nom du codec JSON, utilisé par défaut
+	KindBinary = "binary" // Nom du codec binaire
+)
+
+var (
+	JSON   Codec = jsonCodec{}   // Codec JSON
+	Binary Codec = binaryCodec{} // Codec binaire
+)
+
+// Names retourne les noms des codecs disponibles.
+func Names() []string {
+	return []string{KindJSON, KindBinary}
+}
+
+// New retourne le codec correspondant au nom spécifié dans une configuration. Un nom vide correspond au codec JSON.
+func New(name string) (Codec, error) {
+	switch name {
+	case "", KindJSON:
+		return JSON, nil
+	case KindBinary:
+		return Binary, nil
+	default:
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+}
+
+// Detect retourne le codec avec lequel les octets ont été encodés. Le booléen vaut false si les octets ne
+// correspondent à aucun codec.
+func Detect(data []byte) (Codec, bool) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		return JSON, true
+	case len(data) > 0 && data[0] == binaryTag:
+		return Binary, true
+	default:
+		return nil, false
+	}
+}
+
+// jsonCodec encode les messages en JSON. Le décodage refuse les champs inconnus, ce qui évite de prendre un message
+// pour un autre.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return KindJSON
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
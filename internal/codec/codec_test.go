@@ -0,0 +1,164 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package codec
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// sampleMessage retourne le message d'une vague portant les comptages de cinq processus se partageant l'alphabet,
+// représentatif des messages échangés entre serveurs.
+func sampleMessage() types.WaveMessage {
+	counts := make(types.ProcessCounts)
+	for number := 0; number < 5; number++ {
+		counts[number] = make(map[string]int)
+		for character := 'A' + rune(number)*5; character < 'A'+rune(number+1)*5 && character <= 'Z'; character++ {
+			counts[number][string(character)] = int(character-'A') * 3
+		}
+	}
+	return types.WaveMessage{
+		Type:   types.Wave,
+		ID:     "3f2a9c1e-5b7d-4e8a-9c0f-1d2e3f4a5b6c",
+		Counts: counts,
+		Known:  []int{0, 1, 2, 3, 4},
+		Number: 2,
+		Active: true,
+	}
+}
+
+// seal encode le message dans son enveloppe avec le codec spécifié, comme le fait un serveur avant l'envoi.
+func seal(c Codec, message types.WaveMessage) ([]byte, error) {
+	payload, err := c.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return c.Marshal(types.Envelope{
+		Kind:        types.WaveKind,
+		Version:     types.ProtocolVersion,
+		Sender:      message.Number,
+		Computation: message.ID,
+		Epoch:       time.Now().UnixNano(),
+		Counter:     42,
+		Payload:     payload,
+	})
+}
+
+// TestBinaryRoundTrip vérifie que les messages entre serveurs sont retrouvés à l'identique après un encodage et un
+// décodage avec le codec binaire.
+func TestBinaryRoundTrip(t *testing.T) {
+	text := "l'été à Zürich"
+	counts := types.ProcessCounts{0: {"A": 3, "É": 1}, 4: {}}
+
+	tests := []struct {
+		name    string
+		message any
+	}{
+		{"wave", sampleMessage()},
+		{"probe", types.ProbeEchoMessage{Type: types.Probe, ID: "a", Number: 1, Text: &text, Options: types.TextOptions{CaseSensitive: true, Form: "NFD"}, Budget: -time.Second, Exclude: []int{3}}},
+		{"echo", types.ProbeEchoMessage{Type: types.Echo, ID: "a", Number: 2, Counts: &counts, Known: []int{0, 4}, Unresponsive: []int{-7}}},
+		{"reliable", types.ReliableMessage{Type: types.Data, Number: 3, Epoch: math.MinInt64, Seq: math.MaxUint64, Base: 1, Payload: []byte{0, 1, 255}}},
+		{"heartbeat", types.HeartbeatMessage{Type: "heartbeat", Number: 0, Codecs: []string{"json", "binary"}}},
+		{"election", types.ElectionMessage{Type: "election", Number: 1, Term: 9, Initiator: 1, Leader: 4, Seq: 12}},
+		{"membership", types.MembershipMessage{Type: types.Gossip, Number: 2, Members: []types.Member{{Number: 1, Incarnation: 3}, {Number: 2, Left: true}}}},
+		{"challenge", types.ChallengeMessage{Number: 1, Nonce: make([]byte, 16)}},
+		{"envelope", types.Envelope{Kind: types.WaveKind, Version: types.ProtocolVersion, Sender: 2, Computation: "a", Epoch: 1, Counter: 2, Nonce: []byte{9}, Payload: []byte("{}"), MAC: []byte{1, 2}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := Binary.Marshal(test.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c, ok := Detect(data); !ok || c != Binary {
+				t.Fatal("encoded message not detected as binary")
+			}
+
+			decoded := reflect.New(reflect.TypeOf(test.message))
+			if err := Binary.Unmarshal(data, decoded.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded.Elem().Interface(), test.message) {
+				t.Fatalf("decoded %+v, want %+v", decoded.Elem().Interface(), test.message)
+			}
+		})
+	}
+}
+
+// TestBinaryUnmarshalInvalid vérifie que des octets invalides sont refusés sans panique.
+func TestBinaryUnmarshalInvalid(t *testing.T) {
+	data, err := Binary.Marshal(sampleMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"missing tag", data[1:]},
+		{"JSON", []byte(`{"type":"wave"}`)},
+		{"truncated", data[:len(data)/2]},
+		{"trailing bytes", append(append([]byte{}, data...), 0)},
+		{"oversized length", []byte{binaryTag, 0xff, 0xff, 0xff, 0xff, 0x0f}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var message types.WaveMessage
+			if err := Binary.Unmarshal(test.data, &message); err == nil {
+				t.Fatal("invalid data decoded")
+			}
+		})
+	}
+}
+
+// benchmarkMarshal mesure l'encodage du message représentatif et de son enveloppe avec le codec spécifié.
+func benchmarkMarshal(b *testing.B, c Codec) {
+	message := sampleMessage()
+	data, err := seal(c, message)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := seal(c, message); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "bytes/msg")
+}
+
+// benchmarkUnmarshal mesure le décodage de l'enveloppe du message représentatif et de son contenu avec le codec spécifié.
+func benchmarkUnmarshal(b *testing.B, c Codec) {
+	data, err := seal(c, sampleMessage())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var envelope types.Envelope
+		var message types.WaveMessage
+		if err := c.Unmarshal(data, &envelope); err != nil {
+			b.Fatal(err)
+		}
+		if err := c.Unmarshal(envelope.Payload, &message); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "bytes/msg")
+}
+
+func BenchmarkMarshalJSON(b *testing.B)     { benchmarkMarshal(b, JSON) }
+func BenchmarkMarshalBinary(b *testing.B)   { benchmarkMarshal(b, Binary) }
+func BenchmarkUnmarshalJSON(b *testing.B)   { benchmarkUnmarshal(b, JSON) }
+func BenchmarkUnmarshalBinary(b *testing.B) { benchmarkUnmarshal(b, Binary) }
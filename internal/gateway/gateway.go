@@ -0,0 +1,274 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package gateway propose une passerelle HTTP devant le réseau de serveurs. Elle traduit les requêtes HTTP en commandes
+// envoyées aux serveurs avec le client, ce qui permet d'utiliser le réseau depuis un navigateur ou avec curl.
+//
+// Routes disponibles :
+//   - POST /wave : lance un traitement avec l'algorithme ondulatoire et retourne son identifiant
+//   - POST /probe : lance un traitement avec l'algorithme sondes et échos depuis la racine demandée ou le leader élu et retourne son résultat
+//   - GET /results/{id} : retourne le résultat d'un traitement
+//   - GET /topology : retourne les serveurs du réseau, leurs caractères et la liste d'adjacence
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Lazzzer/labo4-sdr/internal/client"
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const (
+	maxBodySize   = 2 << 20 // Taille maximale en octets du corps d'une requête
+	maxKnownRoots = 1024    // Nombre maximal de racines de traitements sondes et échos retenues par la passerelle
+)
+
+// TextRequest représente le corps des requêtes POST /wave et POST /probe.
+type TextRequest struct {
+	Text    string            `json:"text"`           // Texte à analyser
+	Options types.TextOptions `json:"options"`        // Options de normalisation du texte
+	Root    *int              `json:"root,omitempty"` // Numéro du serveur racine, seulement pour POST /probe, le leader élu si absent
+	Stable  bool              `json:"stable"`         // Variante de l'algorithme ondulatoire terminant à la stabilité, seulement pour POST /wave
+}
+
+// WaveResponse représente la réponse de la requête POST /wave.
+type WaveResponse struct {
+	ID      string `json:"id"`      // Identifiant du traitement lancé
+	Results string `json:"results"` // Chemin de la route retournant le résultat du traitement
+}
+
+// TopologyServer représente un serveur du réseau dans la réponse de la requête GET /topology.
+type TopologyServer struct {
+	Address    string `json:"address"`    // Adresse du serveur
+	Characters string `json:"characters"` // Ensemble des caractères traités par le serveur
+	Neighbors  []int  `json:"neighbors"`  // Numéros des voisins du serveur
+}
+
+// errorResponse représente le corps d'une réponse d'erreur.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Gateway est la passerelle HTTP du réseau de serveurs. Elle doit être créée avec New.
+type Gateway struct {
+	client        *client.Client
+	configuration *types.ServerConfig
+	mux           *http.ServeMux
+
+	mutex sync.Mutex
+	roots map[string]int // Racine de chaque traitement sondes et échos lancé par la passerelle, la clé est l'identifiant du traitement
+	order []string       // Identifiants des traitements dans roots, dans leur ordre de création
+}
+
+// New crée la passerelle du réseau décrit par la configuration, qui envoie ses commandes avec le client spécifié.
+func New(cl *client.Client, configuration *types.ServerConfig) *Gateway {
+	g := &Gateway{
+		client:        cl,
+		configuration: configuration,
+		mux:           http.NewServeMux(),
+		roots:         make(map[string]int),
+	}
+	g.mux.HandleFunc("/wave", g.handleWave)
+	g.mux.HandleFunc("/probe", g.handleProbe)
+	g.mux.HandleFunc("/results/", g.handleResults)
+	g.mux.HandleFunc("/topology", g.handleTopology)
+	return g
+}
+
+// ServeHTTP traite une requête HTTP.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	shared.Log(types.COMMAND, r.Method+" "+r.URL.String()+" from "+r.RemoteAddr)
+	g.mux.ServeHTTP(w, r)
+}
+
+// handleWave lance un traitement avec l'algorithme ondulatoire sur tous les serveurs. Le résultat n'est pas attendu,
+// il est disponible avec GET /results/{id} une fois le traitement terminé.
+func (g *Gateway) handleWave(w http.ResponseWriter, r *http.Request) {
+	request, ok := readTextRequest(w, r)
+	if !ok {
+		return
+	}
+
+	command := types.Command{Type: types.WaveCount, ID: shared.NewComputationID(), Text: request.Text, Options: request.Options}
+	if request.Stable {
+		command.Type = types.WaveStableCount
+	}
+	for _, number := range g.serverNumbers() {
+		if _, err := g.client.Send(command, number, false); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+	writeJSON(w, http.StatusAccepted, WaveResponse{ID: command.ID, Results: "/results/" + command.ID})
+}
+
+// handleProbe lance un traitement avec l'algorithme sondes et échos depuis le serveur racine demandé, ou depuis le
+// leader élu si aucune racine n'est demandée, et retourne son résultat.
+func (g *Gateway) handleProbe(w http.ResponseWriter, r *http.Request) {
+	request, ok := readTextRequest(w, r)
+	if !ok {
+		return
+	}
+	if request.Root == nil {
+		leader, err := g.client.Leader()
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		request.Root = &leader
+	}
+	if _, ok := g.configuration.Servers[*request.Root]; !ok {
+		writeError(w, http.StatusBadRequest, "invalid root server number "+strconv.Itoa(*request.Root))
+		return
+	}
+
+	command := types.Command{Type: types.ProbeCount, ID: shared.NewComputationID(), Text: request.Text, Options: request.Options}
+	g.rememberRoot(command.ID, *request.Root)
+	response, err := g.client.Send(command, *request.Root, true)
+	writeResponse(w, response, err)
+}
+
+// handleResults retourne le résultat d'un traitement. Le serveur interrogé est celui donné par le paramètre "server",
+// sinon la racine du traitement s'il a été lancé par la passerelle avec POST /probe, sinon le premier serveur du réseau.
+func (g *Gateway) handleResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/results/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "invalid computation id")
+		return
+	}
+
+	number, ok := g.rootOf(id)
+	if !ok {
+		number = g.serverNumbers()[0]
+	}
+	if server := r.URL.Query().Get("server"); server != "" {
+		value, err := strconv.Atoi(server)
+		if _, known := g.configuration.Servers[value]; err != nil || !known {
+			writeError(w, http.StatusBadRequest, "invalid server number "+server)
+			return
+		}
+		number = value
+	}
+
+	response, err := g.client.Send(types.Command{Type: types.Ask, ID: id}, number, true)
+	writeResponse(w, response, err)
+}
+
+// handleTopology retourne les serveurs du réseau avec leurs caractères et leurs voisins.
+func (g *Gateway) handleTopology(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+		return
+	}
+
+	topology := make(map[int]TopologyServer)
+	for number, server := range g.configuration.Servers {
+		characters, _ := shared.CharSetOf(server)
+		neighbors := append([]int{}, g.configuration.AdjacencyList[number]...)
+		sort.Ints(neighbors)
+		topology[number] = TopologyServer{
+			Address:    server.Address,
+			Characters: characters.String(),
+			Neighbors:  neighbors,
+		}
+	}
+	writeJSON(w, http.StatusOK, topology)
+}
+
+// rememberRoot retient la racine d'un traitement sondes et échos, seule capable de répondre à une demande de résultat.
+func (g *Gateway) rememberRoot(id string, root int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.roots[id] = root
+	g.order = append(g.order, id)
+	if len(g.order) > maxKnownRoots {
+		delete(g.roots, g.order[0])
+		g.order = g.order[1:]
+	}
+}
+
+// rootOf retourne la racine d'un traitement sondes et échos lancé par la passerelle.
+func (g *Gateway) rootOf(id string) (int, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	root, ok := g.roots[id]
+	return root, ok
+}
+
+// serverNumbers retourne les numéros des serveurs du réseau triés par ordre croissant.
+func (g *Gateway) serverNumbers() []int {
+	numbers := make([]int, 0, len(g.configuration.Servers))
+	for number := range g.configuration.Servers {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// readTextRequest lit et valide le corps d'une requête POST /wave ou POST /probe. En cas d'erreur, la réponse est
+// envoyée et le booléen vaut false.
+func readTextRequest(w http.ResponseWriter, r *http.Request) (*TextRequest, bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+		return nil, false
+	}
+
+	var request TextRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return nil, false
+	}
+	if request.Text == "" {
+		writeError(w, http.StatusBadRequest, "missing text")
+		return nil, false
+	}
+	if err := shared.ValidateTextOptions(request.Options); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return &request, true
+}
+
+// writeResponse envoie la réponse d'un serveur : son résultat, une erreur 404 si le serveur n'a pas de résultat ou
+// une erreur 504 si le serveur n'a pas répondu.
+func writeResponse(w http.ResponseWriter, response *types.Response, err error) {
+	switch {
+	case errors.Is(err, client.ErrUnreachable):
+		writeError(w, http.StatusGatewayTimeout, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err.Error())
+	case response.Result == nil:
+		writeError(w, http.StatusNotFound, response.Error)
+	default:
+		writeJSON(w, http.StatusOK, response.Result)
+	}
+}
+
+// writeError envoie une réponse d'erreur au format JSON.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+// writeJSON envoie une réponse au format JSON avec le statut spécifié.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		shared.Log(types.ERROR, err.Error())
+	}
+}
@@ -0,0 +1,279 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/client"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
+)
+
+// backend simule les serveurs du réseau derrière la passerelle sur un réseau en mémoire. Chaque serveur démarré note
+// les commandes reçues et répond à celles qui attendent une réponse.
+type backend struct {
+	network  *transport.MemoryNetwork
+	mutex    sync.Mutex
+	commands map[int][]types.Command // Commandes reçues par chaque serveur
+	results  map[string]int          // Serveur connaissant le résultat de chaque traitement
+	leader   *int                    // Leader annoncé par les serveurs, aucun si nil
+}
+
+// newGateway crée une passerelle devant un réseau de trois serveurs dont seuls les serveurs spécifiés sont démarrés.
+func newGateway(t *testing.T, running ...int) (*Gateway, *backend) {
+	t.Helper()
+	b := &backend{
+		network:  transport.NewMemoryNetwork(),
+		commands: make(map[int][]types.Command),
+		results:  make(map[string]int),
+	}
+	configuration := &types.ServerConfig{
+		Servers: map[int]types.Server{
+			0: {Characters: []string{"A-H"}, Address: "server-0"},
+			1: {Characters: []string{"I-P"}, Address: "server-1"},
+			2: {Characters: []string{"Q-Z"}, Address: "server-2"},
+		},
+		AdjacencyList: map[int][]int{0: {1}, 1: {2, 0}, 2: {1}},
+	}
+	servers := make(map[int]string)
+	for number, server := range configuration.Servers {
+		servers[number] = server.Address
+	}
+	for _, number := range running {
+		b.start(t, number, configuration.Servers[number].Address)
+	}
+	return New(&client.Client{Servers: servers, Network: b.network}, configuration), b
+}
+
+// start démarre le serveur simulé du processus spécifié.
+func (b *backend) start(t *testing.T, number int, address string) {
+	t.Helper()
+	server, err := b.network.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	go func() {
+		for packet := range server.Receive() {
+			var command types.Command
+			if err := json.Unmarshal(packet.Data, &command); err != nil {
+				continue
+			}
+			if response := b.handle(number, command); response != nil {
+				data, _ := json.Marshal(response)
+				server.Send(packet.From, data)
+			}
+		}
+	}()
+}
+
+// handle note la commande reçue par le serveur spécifié et retourne sa réponse, ou nil si aucune réponse n'est attendue.
+func (b *backend) handle(number int, command types.Command) *types.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.commands[number] = append(b.commands[number], command)
+	response := &types.Response{Server: number}
+	switch command.Type {
+	case types.Leader:
+		if b.leader == nil {
+			response.Error = "no leader elected yet"
+		}
+		response.Leader = b.leader
+	case types.ProbeCount:
+		b.results[command.ID] = number
+		response.Result = &types.Result{ID: command.ID, Algorithm: types.ProbeCount, Root: &number, Text: command.Text, Counts: map[string]int{"A": 1}}
+	case types.Ask:
+		if server, ok := b.results[command.ID]; !ok || server != number {
+			response.Error = "no computation with this id"
+		} else {
+			response.Result = &types.Result{ID: command.ID, Algorithm: types.ProbeCount, Counts: map[string]int{"A": 1}}
+		}
+	default:
+		return nil
+	}
+	return response
+}
+
+// received retourne les commandes reçues par le serveur spécifié.
+func (b *backend) received(number int) []types.Command {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]types.Command{}, b.commands[number]...)
+}
+
+// serve envoie la requête à la passerelle et retourne la réponse enregistrée.
+func serve(g *Gateway, method string, target string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	g.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+// decode décode le corps JSON de la réponse de la passerelle.
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &value); err != nil {
+		t.Fatalf("invalid response body %q: %v", recorder.Body.String(), err)
+	}
+	return value
+}
+
+// TestGatewayRejectsInvalidRequests vérifie les erreurs 4xx de chaque route pour une méthode, un corps ou un
+// paramètre invalide, sans qu'aucune commande ne soit envoyée aux serveurs.
+func TestGatewayRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"GET /wave", http.MethodGet, "/wave", "", http.StatusMethodNotAllowed},
+		{"wave without body", http.MethodPost, "/wave", "", http.StatusBadRequest},
+		{"wave with invalid JSON", http.MethodPost, "/wave", `{"text":`, http.StatusBadRequest},
+		{"wave with unknown field", http.MethodPost, "/wave", `{"text":"a","txt":"b"}`, http.StatusBadRequest},
+		{"wave without text", http.MethodPost, "/wave", `{"options":{}}`, http.StatusBadRequest},
+		{"wave with invalid form", http.MethodPost, "/wave", `{"text":"a","options":{"form":"NFX"}}`, http.StatusBadRequest},
+		{"wave with a body too large", http.MethodPost, "/wave", `{"text":"` + strings.Repeat("a", maxBodySize) + `"}`, http.StatusBadRequest},
+		{"DELETE /probe", http.MethodDelete, "/probe", `{"text":"a"}`, http.StatusMethodNotAllowed},
+		{"probe without text", http.MethodPost, "/probe", `{"root":0}`, http.StatusBadRequest},
+		{"probe with unknown root", http.MethodPost, "/probe", `{"text":"a","root":7}`, http.StatusBadRequest},
+		{"POST /results", http.MethodPost, "/results/a", "", http.StatusMethodNotAllowed},
+		{"results without id", http.MethodGet, "/results/", "", http.StatusNotFound},
+		{"results with nested path", http.MethodGet, "/results/a/b", "", http.StatusNotFound},
+		{"results on unknown server", http.MethodGet, "/results/a?server=7", "", http.StatusBadRequest},
+		{"results on invalid server", http.MethodGet, "/results/a?server=x", "", http.StatusBadRequest},
+		{"POST /topology", http.MethodPost, "/topology", "", http.StatusMethodNotAllowed},
+		{"unknown route", http.MethodGet, "/leader", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, b := newGateway(t, 0, 1, 2)
+			recorder := serve(g, test.method, test.target, test.body)
+			if recorder.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+			for number := 0; number < 3; number++ {
+				if commands := b.received(number); len(commands) != 0 {
+					t.Fatalf("P%d received %v", number, commands)
+				}
+			}
+		})
+	}
+}
+
+// TestGatewayWave vérifie que POST /wave envoie la commande à tous les serveurs et retourne l'identifiant du traitement.
+func TestGatewayWave(t *testing.T) {
+	for _, stable := range []bool{false, true} {
+		g, b := newGateway(t, 0, 1, 2)
+		body := `{"text":"la pomme"}`
+		algorithm := types.WaveCount
+		if stable {
+			body, algorithm = `{"text":"la pomme","stable":true}`, types.WaveStableCount
+		}
+
+		recorder := serve(g, http.MethodPost, "/wave", body)
+		if recorder.Code != http.StatusAccepted {
+			t.Fatalf("status %d, want %d: %s", recorder.Code, http.StatusAccepted, recorder.Body.String())
+		}
+		response := decode[WaveResponse](t, recorder)
+		if response.ID == "" || response.Results != "/results/"+response.ID {
+			t.Fatalf("response %+v, want the computation id and its results path", response)
+		}
+		for number := 0; number < 3; number++ {
+			for start := time.Now(); len(b.received(number)) == 0 && time.Since(start) < time.Second; {
+				time.Sleep(10 * time.Millisecond)
+			}
+			commands := b.received(number)
+			if len(commands) != 1 || commands[0].Type != algorithm || commands[0].ID != response.ID || commands[0].Text != "la pomme" {
+				t.Fatalf("P%d received %+v, want the %s command %s", number, commands, algorithm, response.ID)
+			}
+		}
+	}
+}
+
+// TestGatewayProbe vérifie que POST /probe retourne le résultat de la racine demandée ou du leader élu, et que le
+// résultat est ensuite demandé à cette racine par GET /results/{id}.
+func TestGatewayProbe(t *testing.T) {
+	g, b := newGateway(t, 0, 1, 2)
+	leader := 2
+	b.leader = &leader
+
+	for _, test := range []struct {
+		body string
+		root int
+	}{
+		{`{"text":"la pomme","root":1}`, 1},
+		{`{"text":"la pomme"}`, leader},
+	} {
+		recorder := serve(g, http.MethodPost, "/probe", test.body)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+		}
+		result := decode[types.Result](t, recorder)
+		if result.Root == nil || *result.Root != test.root || result.Text != "la pomme" {
+			t.Fatalf("result %+v, want a result of P%d", result, test.root)
+		}
+
+		recorder = serve(g, http.MethodGet, "/results/"+result.ID, "")
+		if recorder.Code != http.StatusOK || decode[types.Result](t, recorder).ID != result.ID {
+			t.Fatalf("status %d for the results of the root: %s", recorder.Code, recorder.Body.String())
+		}
+		recorder = serve(g, http.MethodGet, "/results/"+result.ID+"?server=0", "")
+		if recorder.Code != http.StatusNotFound {
+			t.Fatalf("status %d for the results of another server, want %d", recorder.Code, http.StatusNotFound)
+		}
+	}
+}
+
+// TestGatewayTopology vérifie que GET /topology retourne les serveurs avec leurs caractères et leurs voisins triés.
+func TestGatewayTopology(t *testing.T) {
+	g, _ := newGateway(t)
+	recorder := serve(g, http.MethodGet, "/topology", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", recorder.Code, http.StatusOK)
+	}
+	topology := decode[map[int]TopologyServer](t, recorder)
+	if len(topology) != 3 || topology[1].Address != "server-1" || topology[1].Characters != "I-P" || len(topology[1].Neighbors) != 2 || topology[1].Neighbors[0] != 0 {
+		t.Fatalf("topology %+v", topology)
+	}
+}
+
+// TestGatewayUnreachableServers vérifie les erreurs 5xx lorsque les serveurs interrogés ne sont pas démarrés.
+func TestGatewayUnreachableServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		running []int
+		method  string
+		target  string
+		body    string
+	}{
+		{"wave with a server down", []int{0, 1}, http.MethodPost, "/wave", `{"text":"a"}`},
+		{"probe on a root down", []int{0, 1}, http.MethodPost, "/probe", `{"text":"a","root":2}`},
+		{"probe without any server to ask for the leader", nil, http.MethodPost, "/probe", `{"text":"a"}`},
+		{"results of a server down", []int{1, 2}, http.MethodGet, "/results/a", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, _ := newGateway(t, test.running...)
+			recorder := serve(g, test.method, test.target, test.body)
+			if recorder.Code < 500 {
+				t.Fatalf("status %d, want a server error: %s", recorder.Code, recorder.Body.String())
+			}
+			if decode[errorResponse](t, recorder).Error == "" {
+				t.Fatal("error response without message")
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const (
+	defaultRateLimit                 = 10.0             // Nombre de commandes par seconde autorisées par défaut pour chaque client
+	defaultRateBurst                 = 20               // Nombre de commandes qu'un client peut envoyer d'un coup par défaut
+	defaultMaxConcurrentComputations = 8                // Nombre maximal par défaut de traitements demandés par des clients en cours
+	defaultMaxQueuedComputations     = 16               // Nombre maximal par défaut de traitements demandés par des clients en attente
+	maxQueueWait                     = 30 * time.Second // Durée maximale d'attente d'une place par un traitement
+	maxIdleBuckets                   = 1024             // Nombre de clients mémorisés au-delà duquel les clients inactifs sont oubliés
+	rejectionRate                    = 5.0              // Nombre de réponses de refus envoyées par seconde, tous clients confondus
+	rejectionBurst                   = 10               // Nombre de réponses de refus pouvant être envoyées d'un coup
+)
+
+// admission contrôle les commandes reçues des clients avant leur traitement.
+//
+// Seuls les clients dont l'adresse appartient à une des plages autorisées peuvent envoyer des commandes. Chaque
+// adresse dispose d'un seau de jetons rempli au rythme de la limite configurée : une commande consomme un jeton et
+// une commande reçue alors que le seau est vide est refusée. Enfin, le nombre de traitements demandés par des clients
+// et en cours sur le serveur est limité, afin qu'un client ne puisse pas accaparer le serveur : un traitement demandé
+// alors que toutes les places sont occupées attend qu'une place se libère dans une file d'attente de taille limitée.
+// Un traitement est refusé si la file est pleine ou s'il n'a pas obtenu de place après maxQueueWait.
+//
+// L'adresse d'un client UDP pouvant être usurpée, un client non autorisé ne reçoit pas de réponse et les réponses aux
+// commandes dépassant la limite ont leur propre seau de jetons, commun à tous les clients, pour que le serveur ne
+// puisse pas être utilisé pour inonder un tiers de réponses.
+type admission struct {
+	mutex      sync.Mutex
+	allowed    []*net.IPNet            // Plages d'adresses des clients autorisés, tous les clients si vide
+	rate       float64                 // Nombre de jetons ajoutés par seconde dans le seau de chaque client
+	burst      float64                 // Capacité du seau de chaque client
+	buckets    map[string]*tokenBucket // Seau de jetons de chaque adresse de client
+	rejections tokenBucket             // Seau de jetons des réponses de refus
+	slots      chan struct{}           // Places des traitements demandés par des clients, une place est occupée par traitement en cours
+	queue      chan struct{}           // Places de la file d'attente, une place est occupée par traitement attendant une place
+}
+
+// tokenBucket représente le seau de jetons d'un client.
+type tokenBucket struct {
+	tokens  float64   // Nombre de jetons disponibles
+	updated time.Time // Instant du dernier remplissage
+}
+
+// newAdmission crée le contrôle des commandes des clients à partir de la configuration. Une plage d'adresses ou une
+// limite invalide est refusée.
+func newAdmission(configuration *types.ServerConfig) (*admission, error) {
+	a := &admission{
+		rate:    defaultRateLimit,
+		burst:   defaultRateBurst,
+		buckets: make(map[string]*tokenBucket),
+
+		rejections: tokenBucket{tokens: rejectionBurst, updated: time.Now()},
+	}
+
+	for _, cidr := range configuration.AllowedClients {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed client range %q", cidr)
+		}
+		a.allowed = append(a.allowed, network)
+	}
+
+	if configuration.RateLimit < 0 || configuration.RateBurst < 0 || configuration.MaxConcurrentComputations < 0 || configuration.MaxQueuedComputations < 0 {
+		return nil, fmt.Errorf("client limits cannot be negative")
+	}
+	if configuration.RateLimit > 0 {
+		a.rate = configuration.RateLimit
+	}
+	if configuration.RateBurst > 0 {
+		a.burst = float64(configuration.RateBurst)
+	}
+	size := defaultMaxConcurrentComputations
+	if configuration.MaxConcurrentComputations > 0 {
+		size = configuration.MaxConcurrentComputations
+	}
+	a.slots = make(chan struct{}, size)
+	size = defaultMaxQueuedComputations
+	if configuration.MaxQueuedComputations > 0 {
+		size = configuration.MaxQueuedComputations
+	}
+	a.queue = make(chan struct{}, size)
+	return a, nil
+}
+
+// admit vérifie que le client à l'adresse spécifiée peut envoyer une commande et consomme un de ses jetons. L'adresse
+// doit être celle d'où provient réellement la commande. L'erreur retournée est la raison du refus, et reply indique
+// si elle peut être communiquée au client.
+func (a *admission) admit(from string) (reply bool, err error) {
+	host, _, err := net.SplitHostPort(from)
+	if err != nil {
+		host = from
+	}
+
+	if len(a.allowed) > 0 {
+		ip := net.ParseIP(host)
+		allowed := false
+		for _, network := range a.allowed {
+			if ip != nil && network.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, fmt.Errorf("client %s is not allowed to send commands", host)
+		}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	if len(a.buckets) > maxIdleBuckets {
+		for address, bucket := range a.buckets {
+			if bucket.refill(now, a.rate, a.burst) >= a.burst {
+				delete(a.buckets, address)
+			}
+		}
+	}
+
+	bucket, ok := a.buckets[host]
+	if !ok {
+		bucket = &tokenBucket{tokens: a.burst, updated: now}
+		a.buckets[host] = bucket
+	}
+	if bucket.refill(now, a.rate, a.burst) < 1 {
+		reply = a.rejections.refill(now, rejectionRate, rejectionBurst) >= 1
+		if reply {
+			a.rejections.tokens--
+		}
+		return reply, fmt.Errorf("rate limit of %s command(s) per second exceeded, try again later", strconv.FormatFloat(a.rate, 'g', -1, 64))
+	}
+	bucket.tokens--
+	return false, nil
+}
+
+// acquire réserve une place pour un traitement demandé par un client. Si toutes les places sont occupées, le traitement
+// attend dans la file d'attente qu'une place se libère, au plus maxQueueWait ou jusqu'à l'annulation du contexte. Une
+// erreur est retournée si la file est pleine ou si aucune place n'a été obtenue, la place doit sinon être libérée avec
+// release à la fin du traitement.
+func (a *admission) acquire(ctx context.Context) error {
+	select {
+	case a.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	select {
+	case a.queue <- struct{}{}:
+		defer func() { <-a.queue }()
+	default:
+		return fmt.Errorf("server busy, %d computation(s) in progress and %d waiting, try again later", cap(a.slots), cap(a.queue))
+	}
+
+	timer := time.NewTimer(maxQueueWait)
+	defer timer.Stop()
+	select {
+	case a.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("server stopped while the computation was waiting")
+	case <-timer.C:
+		return fmt.Errorf("server busy, no computation finished within %s, try again later", maxQueueWait)
+	}
+}
+
+// release libère la place d'un traitement terminé.
+func (a *admission) release() {
+	<-a.slots
+}
+
+// refill ajoute au seau les jetons accumulés depuis son dernier remplissage, sans dépasser sa capacité, et retourne
+// le nombre de jetons disponibles.
+func (b *tokenBucket) refill(now time.Time, rate float64, burst float64) float64 {
+	b.tokens += now.Sub(b.updated).Seconds() * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.updated = now
+	return b.tokens
+}
@@ -0,0 +1,116 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// TestAdmissionAdmit vérifie le contrôle des commandes selon l'adresse d'où elles proviennent.
+func TestAdmissionAdmit(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		from     string
+		admitted bool
+		reply    bool
+	}{
+		{"any client", nil, "192.0.2.1:4000", true, false},
+		{"allowed address", []string{"192.0.2.1"}, "192.0.2.1:4000", true, false},
+		{"allowed range", []string{"192.0.2.0/24"}, "192.0.2.7:4000", true, false},
+		{"client outside the ranges gets no reply", []string{"192.0.2.0/24"}, "198.51.100.1:4000", false, false},
+		{"invalid address", []string{"192.0.2.0/24"}, "server-0", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := newAdmission(&types.ServerConfig{AllowedClients: test.allowed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := a.admit(test.from)
+			if (err == nil) != test.admitted {
+				t.Fatalf("admitted %t, want %t (%v)", err == nil, test.admitted, err)
+			}
+			if reply != test.reply {
+				t.Fatalf("reply %t, want %t", reply, test.reply)
+			}
+		})
+	}
+}
+
+// TestAdmissionRateLimit vérifie que la limite est propre à chaque client et que les réponses de refus sont limitées.
+func TestAdmissionRateLimit(t *testing.T) {
+	a, err := newAdmission(&types.ServerConfig{RateLimit: 0.001, RateBurst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.admit("192.0.2.1:4000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.admit("192.0.2.2:4000"); err != nil {
+		t.Fatalf("limit shared between clients: %v", err)
+	}
+
+	replies := 0
+	for i := 0; i < 10*rejectionBurst; i++ {
+		reply, err := a.admit("192.0.2.1:5000")
+		if err == nil {
+			t.Fatal("command over the limit admitted")
+		}
+		if reply {
+			replies++
+		}
+	}
+	if replies > rejectionBurst+1 {
+		t.Fatalf("%d rejections replied, want at most %d", replies, rejectionBurst+1)
+	}
+}
+
+// TestAdmissionSlots vérifie que les traitements au-delà de la limite attendent une place dans la file d'attente, et
+// que ceux au-delà de la file sont refusés.
+func TestAdmissionSlots(t *testing.T) {
+	a, err := newAdmission(&types.ServerConfig{MaxConcurrentComputations: 2, MaxQueuedComputations: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if a.acquire(ctx) != nil || a.acquire(ctx) != nil {
+		t.Fatal("computation rejected below the limit")
+	}
+	queued := make(chan error)
+	go func() { queued <- a.acquire(ctx) }()
+	for len(a.queue) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := a.acquire(ctx); err == nil {
+		t.Fatal("computation accepted over the queue limit")
+	}
+	select {
+	case err := <-queued:
+		t.Fatalf("queued computation did not wait for a slot: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	a.release()
+	if err := <-queued; err != nil {
+		t.Fatalf("queued computation did not get the released slot: %v", err)
+	}
+	if len(a.queue) != 0 {
+		t.Fatal("queue slot not released")
+	}
+
+	go func() { queued <- a.acquire(ctx) }()
+	cancel()
+	if err := <-queued; err == nil {
+		t.Fatal("queued computation accepted after the server stopped")
+	}
+}
@@ -0,0 +1,122 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// keyring contient les clés avec lesquelles le serveur authentifie les messages échangés avec les autres serveurs.
+//
+// Chaque enveloppe porte un code HMAC-SHA256 calculé avec la clé du lien entre l'émetteur et le destinataire : la clé
+// propre au lien si la configuration en donne une, la clé partagée par tous les serveurs sinon. Le code couvre tous
+// les champs de l'enveloppe ainsi que le numéro du destinataire, ce qui empêche de modifier un message ou de le
+// renvoyer à un autre serveur. Un lien sans clé n'est pas authentifié.
+type keyring struct {
+	number int            // Numéro du processus, destinataire des messages vérifiés
+	shared []byte         // Clé partagée par tous les serveurs, vide si aucune
+	links  map[int][]byte // Clé propre au lien avec chaque processus qui en a une
+}
+
+// newKeyring crée le trousseau de clés du processus spécifié à partir de la configuration. Une clé de lien vide ou
+// désignant un lien entre des serveurs inconnus est refusée.
+func newKeyring(number int, configuration *types.ServerConfig) (*keyring, error) {
+	k := &keyring{number: number, shared: []byte(configuration.Key), links: make(map[int][]byte)}
+	for link, key := range configuration.LinkKeys {
+		ends := strings.Split(link, "-")
+		if len(ends) != 2 {
+			return nil, fmt.Errorf("invalid link %q in link keys, expected \"<server>-<server>\"", link)
+		}
+		a, errA := strconv.Atoi(ends[0])
+		b, errB := strconv.Atoi(ends[1])
+		_, okA := configuration.Servers[a]
+		_, okB := configuration.Servers[b]
+		if errA != nil || errB != nil || !okA || !okB || a == b {
+			return nil, fmt.Errorf("invalid link %q in link keys, expected two different known servers", link)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("empty key for link %q", link)
+		}
+		switch number {
+		case a:
+			k.links[b] = []byte(key)
+		case b:
+			k.links[a] = []byte(key)
+		}
+	}
+	return k, nil
+}
+
+// empty indique si le serveur n'a aucune clé, auquel cas aucun message n'est authentifié.
+func (k *keyring) empty() bool {
+	return len(k.shared) == 0 && len(k.links) == 0
+}
+
+// key retourne la clé du lien avec le processus spécifié, vide si le lien n'est pas authentifié.
+func (k *keyring) key(number int) []byte {
+	if key, ok := k.links[number]; ok {
+		return key
+	}
+	return k.shared
+}
+
+// sign ajoute à l'enveloppe le code d'authentification du message destiné au processus spécifié.
+func (k *keyring) sign(to int, envelope *types.Envelope) {
+	if key := k.key(to); len(key) != 0 {
+		envelope.MAC = digest(key, to, envelope)
+	}
+}
+
+// verify vérifie le code d'authentification d'une enveloppe reçue. Une enveloppe sans code ou avec un code invalide
+// est refusée si le lien avec son émetteur a une clé.
+func (k *keyring) verify(envelope *types.Envelope) error {
+	key := k.key(envelope.Sender)
+	if len(key) == 0 {
+		return nil
+	}
+	if len(envelope.MAC) == 0 {
+		return fmt.Errorf("unauthenticated %s message from P%d", envelope.Kind, envelope.Sender)
+	}
+	if !hmac.Equal(envelope.MAC, digest(key, k.number, envelope)) {
+		return fmt.Errorf("invalid authentication code on %s message from P%d", envelope.Kind, envelope.Sender)
+	}
+	return nil
+}
+
+// digest calcule le code HMAC-SHA256 de l'enveloppe destinée au processus spécifié. Les champs sont préfixés par leur
+// longueur, ce qui rend le calcul indépendant du codec de l'enveloppe et empêche de déplacer des octets d'un champ à
+// l'autre.
+func digest(key []byte, to int, envelope *types.Envelope) []byte {
+	var data []byte
+	data = binary.AppendVarint(data, int64(envelope.Version))
+	data = binary.AppendUvarint(data, uint64(len(envelope.Kind)))
+	data = append(data, envelope.Kind...)
+	data = binary.AppendVarint(data, int64(envelope.Sender))
+	data = binary.AppendVarint(data, int64(to))
+	data = binary.AppendVarint(data, envelope.Epoch)
+	data = binary.AppendUvarint(data, envelope.Counter)
+	data = binary.AppendUvarint(data, uint64(len(envelope.Nonce)))
+	data = append(data, envelope.Nonce...)
+	data = binary.AppendUvarint(data, uint64(len(envelope.Computation)))
+	data = append(data, envelope.Computation...)
+	data = binary.AppendUvarint(data, uint64(len(envelope.Payload)))
+	data = append(data, envelope.Payload...)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
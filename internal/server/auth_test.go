@@ -0,0 +1,121 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// keyringOf retourne le trousseau du processus spécifié dans un réseau de trois serveurs ayant la clé partagée et les
+// clés de liens spécifiées.
+func keyringOf(t *testing.T, number int, key string, linkKeys map[string]string) *keyring {
+	t.Helper()
+	configuration := testConfiguration()
+	configuration.Key = key
+	configuration.LinkKeys = linkKeys
+	k, err := newKeyring(number, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// TestKeyringVerify vérifie les enveloppes signées par un processus et vérifiées par un autre selon leurs clés.
+func TestKeyringVerify(t *testing.T) {
+	links := map[string]string{"0-1": "link key"}
+
+	tests := []struct {
+		name     string
+		signer   *keyring // Trousseau de l'émetteur
+		verifier *keyring // Trousseau du destinataire
+		sender   int      // Émetteur annoncé par l'enveloppe
+		to       int      // Destinataire pour lequel l'enveloppe est signée
+		tamper   func(envelope *types.Envelope)
+		valid    bool
+	}{
+		{"shared key", keyringOf(t, 2, "cluster key", nil), keyringOf(t, 0, "cluster key", nil), 2, 0, nil, true},
+		{"link key", keyringOf(t, 1, "cluster key", links), keyringOf(t, 0, "cluster key", links), 1, 0, nil, true},
+		{"link key without shared key", keyringOf(t, 1, "", links), keyringOf(t, 0, "", links), 1, 0, nil, true},
+		{"no key on either side", keyringOf(t, 1, "", nil), keyringOf(t, 0, "", nil), 1, 0, nil, true},
+		{"shared key instead of the link key", keyringOf(t, 1, "cluster key", nil), keyringOf(t, 0, "cluster key", links), 1, 0, nil, false},
+		{"other shared key", keyringOf(t, 2, "other key", nil), keyringOf(t, 0, "cluster key", nil), 2, 0, nil, false},
+		{"missing key", keyringOf(t, 2, "", nil), keyringOf(t, 0, "cluster key", nil), 2, 0, nil, false},
+		{"wrong recipient", keyringOf(t, 2, "cluster key", nil), keyringOf(t, 0, "cluster key", nil), 2, 1, nil, false},
+		{"sender without the link key", keyringOf(t, 2, "cluster key", links), keyringOf(t, 0, "cluster key", links), 1, 0, nil, false},
+		{
+			name:   "tampered MAC",
+			signer: keyringOf(t, 2, "cluster key", nil), verifier: keyringOf(t, 0, "cluster key", nil), sender: 2, to: 0,
+			tamper: func(envelope *types.Envelope) { envelope.MAC[0] ^= 1 },
+		},
+		{
+			name:   "wrong sender",
+			signer: keyringOf(t, 2, "cluster key", nil), verifier: keyringOf(t, 0, "cluster key", nil), sender: 2, to: 0,
+			tamper: func(envelope *types.Envelope) { envelope.Sender = 1 },
+		},
+		{
+			name:   "tampered payload",
+			signer: keyringOf(t, 2, "cluster key", nil), verifier: keyringOf(t, 0, "cluster key", nil), sender: 2, to: 0,
+			tamper: func(envelope *types.Envelope) { envelope.Payload = []byte(`{"type":"echo"}`) },
+		},
+		{
+			name:   "field bytes moved to another field",
+			signer: keyringOf(t, 2, "cluster key", nil), verifier: keyringOf(t, 0, "cluster key", nil), sender: 2, to: 0,
+			tamper: func(envelope *types.Envelope) {
+				envelope.Computation, envelope.Payload = "a{", []byte(`"type":"wave"}`)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envelope := &types.Envelope{
+				Kind:        types.WaveKind,
+				Version:     types.ProtocolVersion,
+				Sender:      test.sender,
+				Computation: "a",
+				Epoch:       1,
+				Counter:     2,
+				Payload:     []byte(`{"type":"wave"}`),
+			}
+			test.signer.sign(test.to, envelope)
+			if test.tamper != nil {
+				test.tamper(envelope)
+			}
+			if err := test.verifier.verify(envelope); (err == nil) != test.valid {
+				t.Fatalf("valid %t, want %t (%v)", err == nil, test.valid, err)
+			}
+		})
+	}
+}
+
+// TestKeyringLinkKeyPriority vérifie que la clé d'un lien remplace la clé partagée pour ce lien seulement.
+func TestKeyringLinkKeyPriority(t *testing.T) {
+	k := keyringOf(t, 1, "cluster key", map[string]string{"0-1": "link key", "0-2": "other link"})
+	if key := string(k.key(0)); key != "link key" {
+		t.Fatalf("key %q for P0, want the link key", key)
+	}
+	if key := string(k.key(2)); key != "cluster key" {
+		t.Fatalf("key %q for P2, want the shared key", key)
+	}
+}
+
+// TestNewKeyringRejectsInvalidLinks vérifie que les clés de liens mal formées sont refusées.
+func TestNewKeyringRejectsInvalidLinks(t *testing.T) {
+	for _, linkKeys := range []map[string]string{
+		{"0": "key"},
+		{"0-1-2": "key"},
+		{"0-x": "key"},
+		{"0-7": "key"},
+		{"1-1": "key"},
+		{"0-1": ""},
+	} {
+		configuration := testConfiguration()
+		configuration.LinkKeys = linkKeys
+		if _, err := newKeyring(0, configuration); err == nil {
+			t.Errorf("link keys %v accepted", linkKeys)
+		}
+	}
+}
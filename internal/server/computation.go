@@ -0,0 +1,338 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const maxComputations = 64 // Nombre maximal de traitements gardés en mémoire par le serveur
+
+// computationStore regroupe les traitements connus d'un serveur.
+type computationStore struct {
+	mutex  sync.Mutex              // Mutex protégeant les traitements
+	byID   map[string]*computation // Map des traitements connus du serveur, la clé est l'identifiant du traitement
+	order  []string                // Identifiants des traitements dans leur ordre de création
+	lastID string                  // Identifiant du dernier traitement auquel le serveur a participé
+}
+
+// computation représente l'état d'un traitement de texte identifié par un identifiant unique.
+// Plusieurs traitements peuvent se dérouler en même temps sans interférer entre eux.
+type computation struct {
+	ID              string              // Identifiant du traitement
+	Parent          int                 // Numéro du processus parent pour l'algorithme sondes et échos
+	ActiveNeighbors map[int]bool        // Map prenant en clé le numéro du processus voisin et en valeur un booléen pour l'algorithme ondulatoire
+	Known           map[int]bool        // Numéros des processus dont les comptages sont connus
+	Unreachable     map[int]bool        // Numéros des processus écartés car suspectés d'être en panne pour l'algorithme ondulatoire
+	Excluded        map[int]bool        // Numéros des processus écartés par la racine pour l'algorithme sondes et échos
+	Children        map[int]bool        // Numéros des enfants du processus dans l'arbre de l'algorithme sondes et échos
+	CachedTree      bool                // Indique si le texte a été diffusé le long de l'arbre couvrant mémorisé par la racine
+	Counts          types.ProcessCounts // Comptages connus de chaque processus, agrégés seulement lors de la création du résultat
+	Text            string              // Texte à traiter reçu par le serveur
+	Options         types.TextOptions   // Options de normalisation du texte avant le comptage
+	Algorithm       types.CommandType   // Algorithme utilisé pour le traitement
+	StartedAt       time.Time           // Début du traitement sur le serveur
+	FinishedAt      time.Time           // Fin du traitement sur le serveur
+	Partial         bool                // Indique si le traitement a été interrompu par son échéance avant d'avoir reçu tous les comptages
+	Unresponsive    []int               // Numéros des processus n'ayant pas répondu avant l'échéance du traitement
+
+	chansMutex              sync.Mutex                             // Mutex protégeant les maps de files des voisins, créées à la réception de leur premier message
+	waveMessageInboxes      map[int]*inbox[types.WaveMessage]      // Map de files qui gère les messages issus de l'algorithme ondulatoire pour chaque processus voisin
+	probeEchoMessageInboxes map[int]*inbox[types.ProbeEchoMessage] // Map de files qui gère les messages issus de l'algorithme sondes et échos pour chaque processus voisin
+	textProcessedChan       chan bool                              // Channel qui indique si le texte a été traité ou non et bloque le traitement simultané
+	emitterChan             chan bool                              // Channel qui gère si le serveur a déjà émis un message pour ce traitement
+	store                   *computationStore                      // Ensemble des traitements du serveur auquel appartient le traitement
+}
+
+// getComputation retourne le traitement correspondant à l'identifiant et le crée s'il n'existe pas encore.
+// Un traitement peut être créé par la commande d'un client ou par le premier message reçu d'un voisin.
+func (s *Server) getComputation(id string) *computation {
+	store := s.computations
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if c, ok := store.byID[id]; ok {
+		return c
+	}
+
+	c := &computation{
+		ID:                      id,
+		waveMessageInboxes:      make(map[int]*inbox[types.WaveMessage]),
+		probeEchoMessageInboxes: make(map[int]*inbox[types.ProbeEchoMessage]),
+		textProcessedChan:       make(chan bool, 1),
+		emitterChan:             make(chan bool, 1),
+		store:                   store,
+	}
+	c.textProcessedChan <- false
+	c.emitterChan <- false
+
+	store.byID[id] = c
+	store.order = append(store.order, id)
+	store.evict()
+
+	return c
+}
+
+// findComputation retourne le traitement correspondant à l'identifiant, ou le dernier traitement auquel le serveur
+// a participé si l'identifiant est vide. Le booléen vaut false si aucun traitement ne correspond.
+func (s *Server) findComputation(id string) (*computation, bool) {
+	store := s.computations
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if id == "" {
+		id = store.lastID
+	}
+	c, ok := store.byID[id]
+	return c, ok
+}
+
+// setLast retient le traitement comme étant le dernier auquel le serveur a participé.
+func (store *computationStore) setLast(id string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.lastID = id
+}
+
+// evict oublie les plus anciens traitements inactifs lorsque le nombre maximal de traitements est dépassé.
+// Un traitement en cours n'est jamais oublié. Le mutex doit être verrouillé par l'appelant.
+func (store *computationStore) evict() {
+	for i := 0; i < len(store.order) && len(store.order) > maxComputations; {
+		c := store.byID[store.order[i]]
+		if !c.isIdle() || c.ID == store.lastID {
+			i++
+			continue
+		}
+		delete(store.byID, c.ID)
+		store.order = append(store.order[:i], store.order[i+1:]...)
+	}
+}
+
+// waveMessages retourne la file des messages de l'algorithme ondulatoire du voisin spécifié. La file est créée au
+// premier appel, ce qui permet de recevoir les messages d'un voisin ayant rejoint le réseau pendant le traitement.
+func (c *computation) waveMessages(number int) *inbox[types.WaveMessage] {
+	c.chansMutex.Lock()
+	defer c.chansMutex.Unlock()
+
+	b, ok := c.waveMessageInboxes[number]
+	if !ok {
+		b = newInbox[types.WaveMessage]()
+		c.waveMessageInboxes[number] = b
+	}
+	return b
+}
+
+// probeEchoMessages retourne la file des messages de l'algorithme sondes et échos du voisin spécifié. La file est
+// créée au premier appel, comme pour waveMessages.
+func (c *computation) probeEchoMessages(number int) *inbox[types.ProbeEchoMessage] {
+	c.chansMutex.Lock()
+	defer c.chansMutex.Unlock()
+
+	b, ok := c.probeEchoMessageInboxes[number]
+	if !ok {
+		b = newInbox[types.ProbeEchoMessage]()
+		c.probeEchoMessageInboxes[number] = b
+	}
+	return b
+}
+
+// inbox est une file non bornée des messages d'un voisin pour un traitement, dans leur ordre d'arrivée.
+// Le dépôt d'un message ne bloque jamais, ce qui évite qu'un traitement lent bloque la réception de tous les messages
+// du serveur, acquittements et signes de vie compris.
+type inbox[T any] struct {
+	mutex    sync.Mutex
+	messages []T           // Messages en attente
+	ready    chan struct{} // Signale qu'un message a été déposé, de capacité 1
+}
+
+// newInbox crée une file de messages vide.
+func newInbox[T any]() *inbox[T] {
+	return &inbox[T]{ready: make(chan struct{}, 1)}
+}
+
+// put dépose un message dans la file.
+func (b *inbox[T]) put(message T) {
+	b.mutex.Lock()
+	b.messages = append(b.messages, message)
+	b.mutex.Unlock()
+
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take retire le plus ancien message de la file sans attendre. Le booléen vaut false si la file est vide.
+func (b *inbox[T]) take() (T, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var zero T
+	if len(b.messages) == 0 {
+		return zero, false
+	}
+	message := b.messages[0]
+	b.messages[0] = zero
+	b.messages = b.messages[1:]
+	return message, true
+}
+
+// isIdle indique si le traitement n'est pas en cours d'exécution.
+func (c *computation) isIdle() bool {
+	select {
+	case processed := <-c.textProcessedChan:
+		c.textProcessedChan <- processed
+		return true
+	default:
+		return false
+	}
+}
+
+// init permet l'initialisation des variables du traitement en fonction du type d'algorithme utilisé et (ré)initialise la
+// map de compteurs et la map des voisins actifs pour l'algorithme ondulatoire.
+func (c *computation) init(isWave bool, neighbors map[int]types.Server) {
+	c.Counts = make(types.ProcessCounts)
+	c.StartedAt = time.Now()
+	c.FinishedAt = time.Time{}
+	c.Partial = false
+	c.Unresponsive = nil
+	c.Known = make(map[int]bool)
+	c.Children = make(map[int]bool)
+	c.Excluded = nil
+	c.CachedTree = false
+
+	c.Algorithm = types.ProbeCount
+	if isWave {
+		c.Algorithm = types.WaveCount
+		c.Unreachable = make(map[int]bool)
+		c.ActiveNeighbors = make(map[int]bool)
+		for i := range neighbors {
+			c.ActiveNeighbors[i] = true
+		}
+	}
+}
+
+// mergeCounts ajoute les comptages reçus aux comptages connus. Les comptages d'un processus sont propres à un traitement
+// et ne changent pas, ceux déjà connus sont donc simplement remplacés.
+func (c *computation) mergeCounts(counts types.ProcessCounts) {
+	for number, characters := range counts {
+		c.Counts[number] = characters
+	}
+}
+
+// knownProcesses retourne les numéros des processus dont les comptages sont connus, triés par ordre croissant.
+func (c *computation) knownProcesses() []int {
+	return sortedProcesses(c.Known)
+}
+
+// missingProcesses retourne les numéros des processus du réseau dont les comptages ne sont pas connus, triés par ordre croissant.
+func (c *computation) missingProcesses(members map[int]bool) []int {
+	var missing []int
+	for number := range members {
+		if !c.Known[number] {
+			missing = append(missing, number)
+		}
+	}
+	sort.Ints(missing)
+	return missing
+}
+
+// sortedProcesses retourne les numéros de processus de la map triés par ordre croissant.
+func sortedProcesses(processes map[int]bool) []int {
+	numbers := make([]int, 0, len(processes))
+	for number := range processes {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// covers indique si le comptage de chacun des membres spécifiés est connu ou si le membre est écarté car en panne.
+func (c *computation) covers(members map[int]bool) bool {
+	for number := range members {
+		if !c.Known[number] && !c.Unreachable[number] {
+			return false
+		}
+	}
+	return true
+}
+
+// unreachableProcesses retourne les numéros des processus écartés dont le comptage n'est pas connu, triés par ordre croissant.
+func (c *computation) unreachableProcesses() []int {
+	var unreachable []int
+	for number := range c.Unreachable {
+		if !c.Known[number] {
+			unreachable = append(unreachable, number)
+		}
+	}
+	sort.Ints(unreachable)
+	return unreachable
+}
+
+// start marque le traitement comme démarré par le serveur et retourne false s'il l'était déjà.
+func (c *computation) start() bool {
+	if <-c.emitterChan {
+		c.emitterChan <- true
+		return false
+	}
+	c.emitterChan <- true
+	c.store.setLast(c.ID)
+	return true
+}
+
+// computationContext retourne le contexte d'un nouveau traitement, annulé à l'arrêt du serveur ou à l'expiration
+// de la durée maximale d'un traitement.
+func (s *Server) computationContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, s.ComputationTimeout)
+}
+
+// abortComputation termine un traitement interrompu par son échéance ou privé de processus en panne. Le résultat obtenu
+// jusque-là est conservé et marqué comme partiel pour être consulté avec la commande "ask".
+func (s *Server) abortComputation(c *computation) {
+	c.Partial = true
+	shared.Log(types.ERROR, "Computation "+c.ID+" did not reach every process, unresponsive: "+fmt.Sprint(c.Unresponsive))
+	shared.Log(types.INFO, shared.CYAN+"Partial counts: "+fmt.Sprint(c.Counts)+shared.RESET)
+	shared.Log(types.INFO, "Text \""+c.Text+"\" has been partially processed")
+	c.FinishedAt = time.Now()
+	c.textProcessedChan <- true
+}
+
+// receive attend un message dans la file jusqu'à l'annulation du contexte. Un message déjà disponible est toujours
+// retourné, même si le contexte est annulé. Le booléen vaut false si aucun message n'a été reçu.
+func receive[T any](ctx context.Context, b *inbox[T]) (T, bool) {
+	return receiveFrom(ctx, b, nil)
+}
+
+// receiveFrom attend un message d'un voisin dans la file comme receive, mais abandonne aussi l'attente dès que le
+// voisin est suspecté d'être en panne par le détecteur de pannes. Un message déjà disponible est toujours retourné.
+func receiveFrom[T any](ctx context.Context, b *inbox[T], down <-chan struct{}) (T, bool) {
+	for {
+		if message, ok := b.take(); ok {
+			return message, true
+		}
+
+		select {
+		case <-b.ready:
+			continue
+		case <-ctx.Done():
+		case <-down:
+		}
+		// Un message déposé juste avant l'abandon est tout de même retourné
+		return b.take()
+	}
+}
@@ -0,0 +1,105 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// aggregate calcule le nombre d'occurrences de chaque caractère à partir des comptages des processus.
+//
+// Un caractère peut être compté par plusieurs processus lorsque leurs ensembles de caractères se recoupent. Ces
+// processus comptent le même texte et doivent donc être d'accord : le nombre d'occurrences n'est pas additionné mais
+// retenu une seule fois. Un processus qui compte le caractère sans l'avoir trouvé dans le texte l'a compté zéro fois.
+// Lorsque les processus ne sont pas d'accord, le nombre donné par la majorité d'entre eux est retenu, ou celui du plus
+// petit numéro de processus en cas d'égalité, et le caractère est signalé comme conflit.
+func (s *Server) aggregate(counts types.ProcessCounts) (map[string]int, []types.Conflict) {
+	numbers := make([]int, 0, len(counts))
+	charSets := make(map[int]shared.CharSet)
+	for number := range counts {
+		numbers = append(numbers, number)
+		if characters, err := shared.CharSetOf(s.Servers[number]); err == nil {
+			charSets[number] = characters
+		}
+	}
+	sort.Ints(numbers)
+
+	characters := make(map[string]bool)
+	for _, processCounts := range counts {
+		for character, count := range processCounts {
+			if count != 0 {
+				characters[character] = true
+			}
+		}
+	}
+
+	aggregated := make(map[string]int)
+	var conflicts []types.Conflict
+	for character := range characters {
+		r, size := utf8.DecodeRuneInString(character)
+		single := size == len(character)
+
+		byProcess := make(map[int]int)
+		for _, number := range numbers {
+			count, ok := counts[number][character]
+			if ok || (single && charSets[number].Contains(r)) {
+				byProcess[number] = count
+			}
+		}
+
+		retained, agreed := majority(numbers, byProcess)
+		if retained != 0 {
+			aggregated[character] = retained
+		}
+		if !agreed {
+			conflicts = append(conflicts, types.Conflict{Character: character, Counts: byProcess, Retained: retained})
+			shared.Log(types.WARNING, "Processes disagree on the occurrences of "+strconv.Quote(character)+": "+describeCounts(numbers, byProcess))
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Character < conflicts[j].Character })
+	return aggregated, conflicts
+}
+
+// majority retourne le nombre d'occurrences donné par le plus de processus, ou par le plus petit numéro de processus en
+// cas d'égalité, et indique si tous les processus sont d'accord. Les numéros de processus doivent être triés.
+func majority(numbers []int, byProcess map[int]int) (int, bool) {
+	votes := make(map[int]int)
+	for _, count := range byProcess {
+		votes[count]++
+	}
+
+	retained, best := 0, 0
+	for _, number := range numbers {
+		count, ok := byProcess[number]
+		if ok && votes[count] > best {
+			retained, best = count, votes[count]
+		}
+	}
+	return retained, len(votes) <= 1
+}
+
+// describeCounts retourne la liste lisible du nombre d'occurrences donné par chaque processus, triée par numéro de processus.
+func describeCounts(numbers []int, byProcess map[int]int) string {
+	description := ""
+	for _, number := range numbers {
+		if count, ok := byProcess[number]; ok {
+			if description != "" {
+				description += ", "
+			}
+			description += "P" + strconv.Itoa(number) + "=" + strconv.Itoa(count)
+		}
+	}
+	return description
+}
@@ -0,0 +1,116 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// TestAggregate vérifie la fusion des comptages de processus dont les ensembles de caractères se recoupent.
+func TestAggregate(t *testing.T) {
+	// P0, P1 et P2 comptent tous A et B, P3 compte C et P4 compte D, aucun processus ne compte Z
+	s := &Server{Servers: map[int]types.Server{
+		0: {Characters: []string{"A-B"}},
+		1: {Characters: []string{"A-B"}},
+		2: {Characters: []string{"A-B"}},
+		3: {Characters: []string{"C"}},
+		4: {Characters: []string{"C-D"}},
+	}}
+
+	tests := []struct {
+		name       string
+		counts     types.ProcessCounts
+		aggregated map[string]int
+		conflicts  []types.Conflict
+	}{
+		{
+			name:       "replicated characters agree",
+			counts:     types.ProcessCounts{0: {"A": 2, "B": 1}, 1: {"A": 2, "B": 1}, 2: {"A": 2, "B": 1}},
+			aggregated: map[string]int{"A": 2, "B": 1},
+		},
+		{
+			name:       "process without the character counts zero",
+			counts:     types.ProcessCounts{0: {}, 1: {}, 2: {}, 3: {"C": 1}},
+			aggregated: map[string]int{"C": 1},
+		},
+		{
+			name:       "stale process outvoted",
+			counts:     types.ProcessCounts{0: {"A": 2}, 1: {"A": 5}, 2: {"A": 2}},
+			aggregated: map[string]int{"A": 2},
+			conflicts:  []types.Conflict{{Character: "A", Counts: map[int]int{0: 2, 1: 5, 2: 2}, Retained: 2}},
+		},
+		{
+			name:       "process missing an occurrence outvoted",
+			counts:     types.ProcessCounts{0: {}, 1: {"B": 1}, 2: {"B": 1}},
+			aggregated: map[string]int{"B": 1},
+			conflicts:  []types.Conflict{{Character: "B", Counts: map[int]int{0: 0, 1: 1, 2: 1}, Retained: 1}},
+		},
+		{
+			name:       "tie broken by the smallest process number",
+			counts:     types.ProcessCounts{3: {"C": 4}, 4: {"C": 3}},
+			aggregated: map[string]int{"C": 4},
+			conflicts:  []types.Conflict{{Character: "C", Counts: map[int]int{3: 4, 4: 3}, Retained: 4}},
+		},
+		{
+			name:      "tie on zero occurrences",
+			counts:    types.ProcessCounts{3: {}, 4: {"C": 1}},
+			conflicts: []types.Conflict{{Character: "C", Counts: map[int]int{3: 0, 4: 1}, Retained: 0}},
+		},
+		{
+			name:       "character without owner",
+			counts:     types.ProcessCounts{0: {"A": 1}, 1: {"A": 1}, 2: {"A": 1}, 3: {}, 4: {"D": 2}},
+			aggregated: map[string]int{"A": 1, "D": 2},
+		},
+		{
+			name:       "character only reported by a process not configured to count it",
+			counts:     types.ProcessCounts{0: {"A": 1}, 4: {"Z": 3}},
+			aggregated: map[string]int{"A": 1, "Z": 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aggregated, conflicts := s.aggregate(test.counts)
+			if test.aggregated == nil {
+				test.aggregated = map[string]int{}
+			}
+			if !reflect.DeepEqual(aggregated, test.aggregated) {
+				t.Fatalf("counts %v, want %v", aggregated, test.aggregated)
+			}
+			if !reflect.DeepEqual(conflicts, test.conflicts) {
+				t.Fatalf("conflicts %+v, want %+v", conflicts, test.conflicts)
+			}
+		})
+	}
+}
+
+// TestMajority vérifie le nombre d'occurrences retenu selon les votes des processus.
+func TestMajority(t *testing.T) {
+	tests := []struct {
+		name      string
+		numbers   []int
+		byProcess map[int]int
+		retained  int
+		agreed    bool
+	}{
+		{"no process", nil, map[int]int{}, 0, true},
+		{"single process", []int{2}, map[int]int{2: 7}, 7, true},
+		{"agreement", []int{0, 1, 2}, map[int]int{0: 3, 1: 3, 2: 3}, 3, true},
+		{"majority", []int{0, 1, 2}, map[int]int{0: 1, 1: 3, 2: 3}, 3, false},
+		{"tie", []int{1, 4}, map[int]int{1: 5, 4: 2}, 5, false},
+		{"tie won by the count of the smallest number", []int{0, 1, 2, 3}, map[int]int{3: 9, 2: 9, 1: 4, 0: 4}, 4, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retained, agreed := majority(test.numbers, test.byProcess)
+			if retained != test.retained || agreed != test.agreed {
+				t.Fatalf("retained %d and agreed %t, want %d and %t", retained, agreed, test.retained, test.agreed)
+			}
+		})
+	}
+}
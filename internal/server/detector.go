@@ -0,0 +1,212 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/codec"
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const (
+	heartbeatInterval = 500 * time.Millisecond // Intervalle entre deux signes de vie envoyés aux voisins, et entre deux vérifications des voisins
+	suspicionTimeout  = 2 * time.Second        // Délai sans message d'un voisin au-delà duquel il est suspecté d'être en panne
+)
+
+var closedChan = func() chan struct{} { // Channel déjà fermé, retourné pour un processus qui n'est pas un voisin
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// failureDetector représente le détecteur de pannes des voisins d'un serveur.
+//
+// Le détecteur est basé sur un délai : chaque serveur envoie un signe de vie à ses voisins toutes les heartbeatInterval,
+// et tout message reçu d'un voisin, signe de vie ou non, compte comme une preuve de vie. Un voisin dont aucun message n'a
+// été reçu depuis suspicionTimeout est suspecté, jusqu'à ce qu'un nouveau message de sa part soit reçu.
+type failureDetector struct {
+	mutex     sync.Mutex
+	lastSeen  map[int]time.Time     // Réception du dernier message de chaque voisin, ou démarrage du serveur
+	suspected map[int]bool          // Voisins actuellement suspectés
+	down      map[int]chan struct{} // Channel de chaque voisin, fermé lorsque le voisin devient suspect
+}
+
+// newFailureDetector crée le détecteur de pannes des voisins spécifiés. Les voisins sont considérés vivants au démarrage.
+func newFailureDetector(neighbors map[int]types.Server) *failureDetector {
+	d := &failureDetector{
+		lastSeen:  make(map[int]time.Time),
+		suspected: make(map[int]bool),
+		down:      make(map[int]chan struct{}),
+	}
+	now := time.Now()
+	for i := range neighbors {
+		d.lastSeen[i] = now
+		d.down[i] = make(chan struct{})
+	}
+	return d
+}
+
+// heard enregistre la réception d'un message du voisin. Un voisin suspecté est de nouveau considéré vivant.
+func (d *failureDetector) heard(number int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.lastSeen[number]; !ok {
+		return
+	}
+	d.lastSeen[number] = time.Now()
+	if d.suspected[number] {
+		delete(d.suspected, number)
+		d.down[number] = make(chan struct{})
+		shared.Log(types.INFO, shared.GREEN+"P"+strconv.Itoa(number)+" is alive again"+shared.RESET)
+	}
+}
+
+// add commence la surveillance d'un nouveau voisin, considéré vivant.
+func (d *failureDetector) add(number int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.lastSeen[number]; ok {
+		return
+	}
+	d.lastSeen[number] = time.Now()
+	d.down[number] = make(chan struct{})
+}
+
+// remove arrête la surveillance d'un processus qui n'est plus un voisin. Les traitements qui attendent sa réponse
+// l'abandonnent comme s'il était suspecté.
+func (d *failureDetector) remove(number int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.lastSeen[number]; !ok {
+		return
+	}
+	if !d.suspected[number] {
+		close(d.down[number])
+	}
+	delete(d.lastSeen, number)
+	delete(d.suspected, number)
+	d.down[number] = closedChan
+}
+
+// check suspecte les voisins dont aucun message n'a été reçu depuis suspicionTimeout.
+func (d *failureDetector) check() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for number, lastSeen := range d.lastSeen {
+		if d.suspected[number] || time.Since(lastSeen) <= suspicionTimeout {
+			continue
+		}
+		d.suspected[number] = true
+		close(d.down[number])
+		shared.Log(types.WARNING, "P"+strconv.Itoa(number)+" is suspected to have crashed, no message since "+time.Since(lastSeen).Round(time.Millisecond).String())
+	}
+}
+
+// isSuspected indique si le voisin est actuellement suspecté d'être en panne.
+func (d *failureDetector) isSuspected(number int) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.suspected[number]
+}
+
+// suspicion retourne un channel fermé dès que le voisin est suspecté, ou déjà fermé s'il l'est actuellement ou si le
+// processus n'est pas un voisin.
+func (d *failureDetector) suspicion(number int) <-chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if down, ok := d.down[number]; ok {
+		return down
+	}
+	return closedChan
+}
+
+// statuses retourne l'état de chaque voisin, trié par numéro de processus.
+func (d *failureDetector) statuses(neighbors map[int]types.Server) []types.NeighborStatus {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	statuses := make([]types.NeighborStatus, 0, len(d.lastSeen))
+	for number, lastSeen := range d.lastSeen {
+		state := types.Alive
+		if d.suspected[number] {
+			state = types.Suspected
+		}
+		statuses = append(statuses, types.NeighborStatus{
+			Number:     number,
+			Address:    neighbors[number].Address,
+			State:      state,
+			LastSeenMs: time.Since(lastSeen).Milliseconds(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Number < statuses[j].Number })
+	return statuses
+}
+
+// aliveNeighbors retourne les voisins du serveur qui ne sont pas suspectés d'être en panne, les algorithmes ne leur
+// envoient pas de message et n'attendent pas leur réponse.
+func (s *Server) aliveNeighbors() map[int]bool {
+	alive := make(map[int]bool)
+	for i := range s.neighbors() {
+		if s.detector.isSuspected(i) {
+			shared.Log(types.WARNING, "Skipping P"+strconv.Itoa(i)+", suspected to have crashed")
+			continue
+		}
+		alive[i] = true
+	}
+	return alive
+}
+
+// runDetector envoie périodiquement un signe de vie aux voisins et vérifie leur état, jusqu'à l'arrêt du serveur.
+func (s *Server) runDetector() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	heartbeat := types.HeartbeatMessage{Type: types.Heartbeat, Number: s.Number, Codecs: codec.Names()}
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for i := range s.neighbors() {
+			if err := s.sendDatagram(i, types.HeartbeatKind, heartbeat); err != nil {
+				shared.Log(types.ERROR, err.Error())
+			}
+		}
+		s.detector.check()
+	}
+}
+
+// handleHeartbeatMessage traite un signe de vie d'un voisin. La réception de tout message d'un voisin est déjà
+// enregistrée par la couche de livraison fiable, le signe de vie sert donc seulement à apprendre les codecs du voisin.
+func (s *Server) handleHeartbeatMessage(envelope *types.Envelope) error {
+	message, err := decodePayload[types.HeartbeatMessage](envelope)
+	if err != nil {
+		return err
+	}
+	if message.Type != types.Heartbeat {
+		return fmt.Errorf("invalid heartbeat message type %q from P%d", message.Type, envelope.Sender)
+	}
+	s.codecs.learn(message.Number, message.Codecs)
+	return nil
+}
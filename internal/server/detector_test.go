@@ -0,0 +1,94 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
+)
+
+// closed indique si le channel spécifié est fermé.
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// TestFailureDetector vérifie qu'un voisin muet depuis suspicionTimeout est suspecté et que les traitements qui
+// attendent sa réponse en sont avertis, puis qu'il n'est plus suspecté dès qu'un message de sa part est reçu.
+func TestFailureDetector(t *testing.T) {
+	d := newFailureDetector(map[int]types.Server{1: {}, 2: {}})
+	d.check()
+	if d.isSuspected(1) || d.isSuspected(2) || closed(d.suspicion(1)) {
+		t.Fatal("neighbors suspected at start")
+	}
+
+	waiting := d.suspicion(1)
+	d.mutex.Lock()
+	d.lastSeen[1] = time.Now().Add(-suspicionTimeout - time.Millisecond)
+	d.mutex.Unlock()
+	d.check()
+	if !d.isSuspected(1) || !closed(waiting) || !closed(d.suspicion(1)) {
+		t.Fatal("silent neighbor not suspected")
+	}
+	if d.isSuspected(2) {
+		t.Fatal("neighbor heard recently suspected")
+	}
+
+	d.heard(1)
+	if d.isSuspected(1) || closed(d.suspicion(1)) {
+		t.Fatal("neighbor still suspected after a message")
+	}
+	if statuses := d.statuses(nil); len(statuses) != 2 || statuses[0].State != types.Alive || statuses[1].State != types.Alive {
+		t.Fatalf("statuses %+v, want both neighbors alive", statuses)
+	}
+
+	d.heard(3)
+	if d.isSuspected(3) || !closed(d.suspicion(3)) {
+		t.Fatal("process that is not a neighbor monitored")
+	}
+}
+
+// TestFailureDetectorNetwork vérifie sur un réseau en mémoire qu'un voisin arrêté est suspecté dans le délai de
+// suspicion, puis qu'il ne l'est plus une fois redémarré.
+func TestFailureDetectorNetwork(t *testing.T) {
+	if testing.Short() {
+		t.Skip("network test skipped in short mode")
+	}
+	configuration := testConfiguration()
+	network := transport.NewMemoryNetwork()
+	servers := make(map[int]*Server)
+	for number := range configuration.Servers {
+		servers[number] = startServer(t, network, configuration, number, nil)
+	}
+
+	waitSuspected := func(suspected bool, within time.Duration) {
+		t.Helper()
+		for deadline := time.Now().Add(within); servers[0].detector.isSuspected(1) != suspected; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("P1 suspected by P0: %t after %s, want %t", !suspected, within, suspected)
+			}
+		}
+	}
+
+	time.Sleep(suspicionTimeout + heartbeatInterval)
+	if servers[0].detector.isSuspected(1) || servers[2].detector.isSuspected(1) {
+		t.Fatal("running neighbor suspected")
+	}
+
+	servers[1].Close()
+	waitSuspected(true, suspicionTimeout+2*heartbeatInterval)
+	if !servers[2].detector.isSuspected(1) {
+		t.Fatal("stopped neighbor not suspected by P2")
+	}
+
+	servers[1] = startServer(t, network, configuration, 1, nil)
+	waitSuspected(false, 2*heartbeatInterval)
+}
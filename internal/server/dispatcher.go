@@ -0,0 +1,183 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Lazzzer/labo4-sdr/internal/codec"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// handler traite le contenu d'un message d'une sorte donnée.
+type handler func(envelope *types.Envelope) error
+
+// dispatcher transmet chaque message reçu d'un autre serveur au traitement enregistré pour sa sorte, après avoir
+// vérifié son authenticité. Les traitements sont enregistrés à la création du serveur et ne changent plus ensuite.
+type dispatcher struct {
+	handlers  map[types.MessageKind]handler  // Traitement de chaque sorte de message
+	keys      *keyring                       // Clés vérifiant le code d'authentification des messages
+	addresses *addressBook                   // Adresses des serveurs vérifiant l'origine des messages reçus du transport
+	replay    *replayGuard                   // Compteurs écartant les messages rejoués reçus du transport
+	challenge func(number int, nonce []byte) // Envoie un défi au processus dont l'époque n'est pas encore acceptée
+}
+
+// newDispatcher crée le répartiteur des messages du serveur avec le traitement de chaque sorte de message. Si hostOnly
+// est vrai, seule l'adresse IP d'origine des messages est vérifiée.
+func (s *Server) newDispatcher(hostOnly bool) *dispatcher {
+	d := &dispatcher{
+		handlers:  make(map[types.MessageKind]handler),
+		keys:      s.keys,
+		addresses: newAddressBook(s.Servers, hostOnly),
+		replay:    s.replay,
+		challenge: s.sendChallenge,
+	}
+	d.register(types.MembershipKind, s.handleMembershipMessage)
+	d.register(types.ReliableKind, s.handleReliableMessage)
+	d.register(types.HeartbeatKind, s.handleHeartbeatMessage)
+	d.register(types.ProbeEchoKind, s.handleProbeEchoMessage)
+	d.register(types.WaveKind, s.handleWaveMessage)
+	d.register(types.ElectionKind, s.handleElectionMessage)
+	d.register(types.ChallengeKind, s.handleChallengeMessage)
+	return d
+}
+
+// register enregistre le traitement des messages de la sorte spécifiée.
+func (d *dispatcher) register(kind types.MessageKind, h handler) {
+	d.handlers[kind] = h
+}
+
+// receive transmet un message reçu du transport au traitement de sa sorte. En plus des vérifications de dispatch, un
+// message qui ne provient pas réellement de l'adresse de son émetteur dans la configuration ou qui a déjà été reçu est
+// refusé. Un message d'une époque pas encore acceptée est refusé et son émetteur reçoit un défi. Les défis ne sont pas
+// soumis à la vérification des compteurs, l'émetteur d'un défi ayant pu ne jamais recevoir de message du processus.
+func (d *dispatcher) receive(from string, envelope *types.Envelope) error {
+	if err := d.authenticate(envelope); err != nil {
+		return err
+	}
+	if err := d.addresses.check(from, envelope.Sender); err != nil {
+		return err
+	}
+	if envelope.Kind != types.ChallengeKind {
+		if err := d.replay.check(envelope); err != nil {
+			var required *challengeRequired
+			if errors.As(err, &required) && required.nonce != nil {
+				d.challenge(envelope.Sender, required.nonce)
+			}
+			return err
+		}
+	}
+	return d.route(envelope)
+}
+
+// dispatch transmet un message encapsulé dans un message de la couche de livraison fiable au traitement de sa sorte.
+// L'origine et l'unicité d'un tel message sont garanties par le message qui le transporte. Un message d'une autre
+// version du protocole, non authentifié ou d'une sorte inconnue est refusé.
+func (d *dispatcher) dispatch(envelope *types.Envelope) error {
+	if err := d.authenticate(envelope); err != nil {
+		return err
+	}
+	return d.route(envelope)
+}
+
+// authenticate vérifie la version du protocole et le code d'authentification du message.
+func (d *dispatcher) authenticate(envelope *types.Envelope) error {
+	if envelope.Version != types.ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d for %s message from P%d, expected version %d", envelope.Version, envelope.Kind, envelope.Sender, types.ProtocolVersion)
+	}
+	return d.keys.verify(envelope)
+}
+
+// route transmet le message au traitement enregistré pour sa sorte.
+func (d *dispatcher) route(envelope *types.Envelope) error {
+	h, ok := d.handlers[envelope.Kind]
+	if !ok {
+		return fmt.Errorf("unknown message kind %q from P%d", envelope.Kind, envelope.Sender)
+	}
+	return h(envelope)
+}
+
+// seal place le contenu dans une enveloppe de la sorte spécifiée, numérotée et authentifiée avec la clé du lien, et
+// retourne le message prêt à être envoyé au processus spécifié, encodé avec le codec négocié avec celui-ci. Chaque
+// appel produit une enveloppe différente, un message retransmis doit donc être scellé de nouveau.
+func (s *Server) seal(to int, kind types.MessageKind, computation string, payload any) ([]byte, error) {
+	c := s.codecs.forPeer(to)
+	data, err := c.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	envelope := types.Envelope{
+		Kind:        kind,
+		Version:     types.ProtocolVersion,
+		Sender:      s.Number,
+		Computation: computation,
+		Payload:     data,
+	}
+	s.replay.stamp(to, &envelope)
+	s.keys.sign(to, &envelope)
+	return c.Marshal(envelope)
+}
+
+// open retourne l'enveloppe du message reçu, décodée avec le codec du message. Un message qui n'est pas exactement
+// une enveloppe, comme une commande d'un client, est refusé.
+func open(data []byte) (*types.Envelope, error) {
+	c, ok := codec.Detect(data)
+	if !ok {
+		return nil, fmt.Errorf("message has an unknown encoding")
+	}
+	var envelope types.Envelope
+	if err := c.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Kind == "" {
+		return nil, fmt.Errorf("message has no kind")
+	}
+	return &envelope, nil
+}
+
+// decodePayload retourne le contenu de l'enveloppe, décodé avec le codec du contenu. Un contenu JSON contenant des
+// champs inconnus du type attendu ou dont l'émetteur n'est pas celui de l'enveloppe est refusé.
+func decodePayload[T types.MembershipMessage | types.ReliableMessage | types.HeartbeatMessage | types.ProbeEchoMessage | types.WaveMessage | types.ElectionMessage | types.ChallengeMessage](envelope *types.Envelope) (*T, error) {
+	c, ok := codec.Detect(envelope.Payload)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s message from P%d: unknown encoding", envelope.Kind, envelope.Sender)
+	}
+	var payload T
+	if err := c.Unmarshal(envelope.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid %s message from P%d: %w", envelope.Kind, envelope.Sender, err)
+	}
+	if number := senderOf(&payload); number != envelope.Sender {
+		return nil, fmt.Errorf("spoofed sender, %s message from P%d claims to come from P%d", envelope.Kind, envelope.Sender, number)
+	}
+	return &payload, nil
+}
+
+// senderOf retourne le numéro du processus qui a envoyé le message selon son contenu.
+func senderOf(message any) int {
+	switch m := message.(type) {
+	case *types.MembershipMessage:
+		return m.Number
+	case *types.ReliableMessage:
+		return m.Number
+	case *types.HeartbeatMessage:
+		return m.Number
+	case *types.ProbeEchoMessage:
+		return m.Number
+	case *types.WaveMessage:
+		return m.Number
+	case *types.ElectionMessage:
+		return m.Number
+	case *types.ChallengeMessage:
+		return m.Number
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,150 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/codec"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// knownKinds liste les sortes de messages entre serveurs.
+var knownKinds = []types.MessageKind{
+	types.ChallengeKind,
+	types.ElectionKind,
+	types.HeartbeatKind,
+	types.MembershipKind,
+	types.ProbeEchoKind,
+	types.ReliableKind,
+	types.WaveKind,
+}
+
+// recordingDispatcher retourne le répartiteur d'un serveur de test dont chaque traitement enregistré est remplacé par
+// un traitement notant la sorte des messages reçus.
+func recordingDispatcher(t *testing.T) (*dispatcher, *[]types.MessageKind) {
+	t.Helper()
+	d := newTestServer(t, 0).newDispatcher(false)
+	var routed []types.MessageKind
+	for kind := range d.handlers {
+		d.register(kind, func(envelope *types.Envelope) error {
+			routed = append(routed, envelope.Kind)
+			return nil
+		})
+	}
+	return d, &routed
+}
+
+// TestNewDispatcherRegistersKinds vérifie qu'un traitement est enregistré pour chaque sorte de message.
+func TestNewDispatcherRegistersKinds(t *testing.T) {
+	d := newTestServer(t, 0).newDispatcher(false)
+	var kinds []types.MessageKind
+	for kind := range d.handlers {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	if len(kinds) != len(knownKinds) {
+		t.Fatalf("handlers for %v, want %v", kinds, knownKinds)
+	}
+	for i := range kinds {
+		if kinds[i] != knownKinds[i] {
+			t.Fatalf("handlers for %v, want %v", kinds, knownKinds)
+		}
+	}
+}
+
+// TestDispatcherRoutesKnownKinds vérifie que chaque sorte de message connue atteint son traitement.
+func TestDispatcherRoutesKnownKinds(t *testing.T) {
+	for _, kind := range knownKinds {
+		t.Run(string(kind), func(t *testing.T) {
+			d, routed := recordingDispatcher(t)
+			if err := d.dispatch(&types.Envelope{Kind: kind, Version: types.ProtocolVersion, Sender: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if len(*routed) != 1 || (*routed)[0] != kind {
+				t.Fatalf("routed to %v, want the %s handler", *routed, kind)
+			}
+		})
+	}
+}
+
+// TestDispatcherDropsInvalidMessages vérifie que les messages d'une autre version ou d'une sorte inconnue sont refusés
+// sans atteindre aucun traitement.
+func TestDispatcherDropsInvalidMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope types.Envelope
+	}{
+		{"older version", types.Envelope{Kind: types.WaveKind, Version: types.ProtocolVersion - 1, Sender: 1}},
+		{"newer version", types.Envelope{Kind: types.WaveKind, Version: types.ProtocolVersion + 1, Sender: 1}},
+		{"no version", types.Envelope{Kind: types.WaveKind, Sender: 1}},
+		{"unknown kind", types.Envelope{Kind: "gossip", Version: types.ProtocolVersion, Sender: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, routed := recordingDispatcher(t)
+			if err := d.dispatch(&test.envelope); err == nil || len(*routed) != 0 {
+				t.Fatalf("error %v and routed to %v, want a refusal", err, *routed)
+			}
+		})
+	}
+}
+
+// TestDispatcherReceiveRejectsVersion vérifie qu'un message reçu du transport dans une autre version du protocole est
+// refusé avant toute autre vérification.
+func TestDispatcherReceiveRejectsVersion(t *testing.T) {
+	d, routed := recordingDispatcher(t)
+	envelope := &types.Envelope{Kind: types.ChallengeKind, Version: types.ProtocolVersion + 1, Sender: 1}
+	if err := d.receive("server-1", envelope); err == nil || len(*routed) != 0 {
+		t.Fatalf("error %v and routed to %v, want a refusal", err, *routed)
+	}
+	envelope.Version = types.ProtocolVersion
+	if err := d.receive("server-1", envelope); err != nil || len(*routed) != 1 {
+		t.Fatalf("error %v and routed to %v, want the challenge handler", err, *routed)
+	}
+}
+
+// TestOpen vérifie que seuls les messages encodés comme une enveloppe avec une sorte sont acceptés.
+func TestOpen(t *testing.T) {
+	binary, err := codec.Binary.Marshal(types.Envelope{Kind: types.WaveKind, Version: types.ProtocolVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"JSON envelope", []byte(`{"kind":"wave","version":1}`), true},
+		{"binary envelope", binary, true},
+		{"client command", []byte(`{"command_type":"ask"}`), false},
+		{"text", []byte("ask 0"), false},
+		{"empty", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := open(test.data); (err == nil) != test.valid {
+				t.Fatalf("valid %t, want %t (%v)", err == nil, test.valid, err)
+			}
+		})
+	}
+}
+
+// TestDecodePayloadRejectsSpoofedSender vérifie que le contenu d'un message doit provenir de l'émetteur de l'enveloppe.
+func TestDecodePayloadRejectsSpoofedSender(t *testing.T) {
+	payload, err := codec.JSON.Marshal(types.WaveMessage{Type: types.Wave, ID: "a", Number: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodePayload[types.WaveMessage](&types.Envelope{Kind: types.WaveKind, Sender: 2, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodePayload[types.WaveMessage](&types.Envelope{Kind: types.WaveKind, Sender: 1, Payload: payload}); err == nil {
+		t.Fatal("payload of P2 accepted in an envelope of P1")
+	}
+}
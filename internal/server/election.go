@@ -0,0 +1,276 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const (
+	electionTimeout     = 3 * time.Second // Délai d'attente des messages des voisins pendant une élection, au-delà duquel les voisins muets sont considérés comme absents
+	leaderAliveInterval = time.Second     // Intervalle entre deux annonces de vie du leader, et entre deux vérifications de l'état de l'élection
+	leaderTimeout       = 4 * time.Second // Délai sans annonce du leader au-delà duquel une nouvelle élection est lancée
+	noLeader            = -1              // Valeur du leader et de l'initiateur lorsqu'ils ne sont pas connus
+)
+
+// electionState représente l'état de l'élection du leader sur un serveur.
+//
+// L'élection utilise l'algorithme d'écho avec extinction : chaque initiateur lance une vague portant son numéro, et un
+// processus ne participe qu'à la vague la plus forte qu'il connaît, les vagues plus faibles s'éteignant. Un processus
+// atteint par la vague d'un initiateur plus petit que lui lance sa propre vague, si bien que le plus grand numéro du
+// réseau est toujours initiateur. Seule sa vague revient complètement, et il devient le leader et l'annonce à tout le réseau.
+// Le leader diffuse ensuite régulièrement une annonce de vie. Sans annonce pendant leaderTimeout, une nouvelle élection
+// est lancée avec un numéro d'élection plus grand, qui remplace l'élection précédente.
+type electionState struct {
+	mutex     sync.Mutex
+	term      int          // Numéro de l'élection en cours ou de la dernière élection
+	leader    int          // Leader élu pour l'élection term, noLeader si aucun
+	wave      int          // Initiateur de la vague la plus forte connue pour l'élection term, noLeader si aucune
+	parent    int          // Voisin duquel la vague courante a été reçue en premier
+	received  map[int]bool // Voisins dont un message de la vague courante a été reçu
+	done      bool         // Indique si le processus a terminé sa participation à la vague courante
+	started   time.Time    // Début de la participation à la vague courante, ou démarrage du serveur
+	lastAlive time.Time    // Réception de la dernière annonce du leader
+	aliveSeq  uint64       // Numéro de la dernière annonce du leader reçue ou envoyée
+}
+
+// newElectionState crée l'état d'élection d'un serveur qui vient de démarrer et ne connaît aucun leader.
+func newElectionState() *electionState {
+	return &electionState{
+		leader:   noLeader,
+		wave:     noLeader,
+		received: make(map[int]bool),
+		started:  time.Now(),
+	}
+}
+
+// currentLeader retourne le leader élu connu du serveur. Le booléen vaut false si aucun leader n'est connu.
+func (s *Server) currentLeader() (int, bool) {
+	e := s.election
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.leader, e.leader != noLeader
+}
+
+// runElection surveille l'élection jusqu'à l'arrêt du serveur. Le leader diffuse ses annonces de vie, les autres
+// processus lancent une nouvelle élection lorsque le leader ne donne plus signe de vie ou qu'aucun leader n'est connu.
+// Au démarrage, le serveur attend leaderTimeout avant de lancer une élection afin d'apprendre un éventuel leader déjà élu.
+func (s *Server) runElection() {
+	ticker := time.NewTicker(leaderAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		e := s.election
+		e.mutex.Lock()
+		switch {
+		case e.leader == s.Number:
+			e.aliveSeq++
+			message := types.ElectionMessage{Type: types.LeaderAlive, Number: s.Number, Term: e.term, Leader: s.Number, Seq: e.aliveSeq}
+			e.mutex.Unlock()
+			s.floodDatagram(message, noLeader)
+		case e.leader != noLeader && time.Since(e.lastAlive) > leaderTimeout:
+			shared.Log(types.WARNING, "Leader P"+strconv.Itoa(e.leader)+" stopped responding, starting a new election")
+			s.startElection(e, e.term+1)
+			e.mutex.Unlock()
+		case e.leader == noLeader && e.wave != noLeader && !e.done && time.Since(e.started) > electionTimeout:
+			s.completeWave(e)
+			e.mutex.Unlock()
+		case e.leader == noLeader && time.Since(e.started) > leaderTimeout:
+			s.startElection(e, e.term+1)
+			e.mutex.Unlock()
+		default:
+			e.mutex.Unlock()
+		}
+	}
+}
+
+// startElection lance une vague d'élection dont le serveur est l'initiateur. Le mutex de l'élection doit être verrouillé
+// par l'appelant.
+func (s *Server) startElection(e *electionState, term int) {
+	shared.Log(types.INFO, "Starting election #"+strconv.Itoa(term))
+	e.term = term
+	e.leader = noLeader
+	e.wave = s.Number
+	e.parent = s.Number
+	e.received = make(map[int]bool)
+	e.done = false
+	e.started = time.Now()
+
+	message := types.ElectionMessage{Type: types.Election, Number: s.Number, Term: term, Initiator: s.Number}
+	neighbors := s.neighbors()
+	for i := range neighbors {
+		s.sendElectionMessage(message, i)
+	}
+	if len(neighbors) == 0 {
+		s.completeWave(e)
+	}
+}
+
+// completeWave termine la participation du serveur à la vague courante, lorsque tous les voisins ont répondu ou que
+// le délai d'attente est dépassé. L'initiateur de la vague devient le leader, les autres processus renvoient la vague
+// à leur parent. Le mutex de l'élection doit être verrouillé par l'appelant.
+func (s *Server) completeWave(e *electionState) {
+	e.done = true
+	neighbors := s.neighbors()
+	if len(e.received) < len(neighbors) {
+		missing := ""
+		for i := range neighbors {
+			if !e.received[i] {
+				missing += " P" + strconv.Itoa(i)
+			}
+		}
+		shared.Log(types.WARNING, "Election #"+strconv.Itoa(e.term)+" completed without answer from"+missing)
+	}
+
+	if e.wave != s.Number {
+		s.sendElectionMessage(types.ElectionMessage{Type: types.Election, Number: s.Number, Term: e.term, Initiator: e.wave}, e.parent)
+		return
+	}
+
+	e.leader = s.Number
+	e.lastAlive = time.Now()
+	e.aliveSeq = 0
+	shared.Log(types.INFO, shared.GREEN+"Elected as leader for election #"+strconv.Itoa(e.term)+shared.RESET)
+	message := types.ElectionMessage{Type: types.Coordinator, Number: s.Number, Term: e.term, Leader: s.Number}
+	for i := range s.neighbors() {
+		s.sendElectionMessage(message, i)
+	}
+}
+
+// handleElectionMessage traite un message de l'élection du leader.
+func (s *Server) handleElectionMessage(envelope *types.Envelope) error {
+	message, err := decodePayload[types.ElectionMessage](envelope)
+	if err != nil {
+		return err
+	}
+
+	e := s.election
+	switch message.Type {
+	case types.Election:
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		s.handleElectionWave(e, message)
+	case types.Coordinator:
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		if !e.adoptLeader(message) {
+			return nil
+		}
+		e.done = true
+		shared.Log(types.INFO, shared.GREEN+"P"+strconv.Itoa(message.Leader)+" elected as leader for election #"+strconv.Itoa(message.Term)+shared.RESET)
+		forwarded := types.ElectionMessage{Type: types.Coordinator, Number: s.Number, Term: message.Term, Leader: message.Leader}
+		for i := range s.neighbors() {
+			if i != message.Number {
+				s.sendElectionMessage(forwarded, i)
+			}
+		}
+	case types.LeaderAlive:
+		e.mutex.Lock()
+		adopted := e.adoptLeader(message)
+		if !adopted && (message.Term != e.term || message.Leader != e.leader || message.Seq <= e.aliveSeq) {
+			e.mutex.Unlock()
+			return nil
+		}
+		if adopted {
+			shared.Log(types.INFO, "P"+strconv.Itoa(message.Leader)+" is the leader of election #"+strconv.Itoa(message.Term))
+		}
+		e.aliveSeq = message.Seq
+		e.lastAlive = time.Now()
+		e.mutex.Unlock()
+		s.floodDatagram(types.ElectionMessage{Type: types.LeaderAlive, Number: s.Number, Term: message.Term, Leader: message.Leader, Seq: message.Seq}, message.Number)
+	default:
+		return fmt.Errorf("invalid message type")
+	}
+	return nil
+}
+
+// handleElectionWave traite un message d'une vague d'élection. Une vague plus forte que la vague courante, par son numéro
+// d'élection puis par son initiateur, est rejointe et transmise aux autres voisins, à moins que son initiateur soit plus
+// petit que le serveur, qui lance alors sa propre vague pour cette élection. Une vague plus faible est ignorée.
+// Le mutex de l'élection doit être verrouillé par l'appelant.
+func (s *Server) handleElectionWave(e *electionState, message *types.ElectionMessage) {
+	if message.Term < e.term || (message.Term == e.term && message.Initiator < e.wave) {
+		return
+	}
+	if message.Initiator < s.Number && (message.Term > e.term || e.wave < s.Number) {
+		s.startElection(e, message.Term)
+		return
+	}
+
+	if message.Term > e.term || message.Initiator > e.wave {
+		if message.Term > e.term {
+			e.leader = noLeader
+		}
+		e.term = message.Term
+		e.wave = message.Initiator
+		e.parent = message.Number
+		e.received = map[int]bool{message.Number: true}
+		e.done = false
+		e.started = time.Now()
+
+		forwarded := types.ElectionMessage{Type: types.Election, Number: s.Number, Term: message.Term, Initiator: message.Initiator}
+		for i := range s.neighbors() {
+			if i != message.Number {
+				s.sendElectionMessage(forwarded, i)
+			}
+		}
+	} else {
+		e.received[message.Number] = true
+	}
+
+	if !e.done && len(e.received) >= len(s.neighbors()) {
+		s.completeWave(e)
+	}
+}
+
+// adoptLeader retient le leader annoncé par le message s'il est plus récent que le leader connu, ou plus grand pour une
+// même élection. Elle retourne false si l'annonce est ignorée. Le mutex de l'élection doit être verrouillé par l'appelant.
+func (e *electionState) adoptLeader(message *types.ElectionMessage) bool {
+	if message.Term < e.term || (message.Term == e.term && message.Leader <= e.leader) {
+		return false
+	}
+	e.term = message.Term
+	e.leader = message.Leader
+	e.lastAlive = time.Now()
+	e.aliveSeq = 0
+	return true
+}
+
+// sendElectionMessage envoie un message d'élection à un voisin avec la couche de livraison fiable.
+func (s *Server) sendElectionMessage(message types.ElectionMessage, number int) {
+	if err := sendMessage(s, message, number); err != nil {
+		shared.Log(types.ERROR, err.Error())
+	}
+}
+
+// floodDatagram envoie un message d'élection en datagramme à tous les voisins sauf celui spécifié.
+func (s *Server) floodDatagram(message types.ElectionMessage, except int) {
+	for i := range s.neighbors() {
+		if i == except {
+			continue
+		}
+		if err := s.sendDatagram(i, types.ElectionKind, message); err != nil {
+			shared.Log(types.ERROR, err.Error())
+		}
+	}
+}
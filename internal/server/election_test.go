@@ -0,0 +1,71 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// electionWait est le délai maximal d'une élection dans les tests, le temps pour un serveur de constater l'absence de
+// leader et de terminer sa vague en attendant éventuellement des voisins muets.
+const electionWait = leaderTimeout + 2*electionTimeout + responseTimeout
+
+// waitLeader attend que tous les serveurs spécifiés connaissent le leader attendu et retourne le numéro de l'élection
+// du premier serveur.
+func waitLeader(t *testing.T, servers []*Server, leader int) int {
+	t.Helper()
+	deadline := time.Now().Add(electionWait)
+	for {
+		agreed := true
+		for _, s := range servers {
+			current, ok := s.currentLeader()
+			agreed = agreed && ok && current == leader
+		}
+		if agreed {
+			e := servers[0].election
+			e.mutex.Lock()
+			defer e.mutex.Unlock()
+			return e.term
+		}
+		if time.Now().After(deadline) {
+			for _, s := range servers {
+				current, ok := s.currentLeader()
+				t.Logf("P%d knows leader P%d: %t", s.Number, current, ok)
+			}
+			t.Fatalf("servers do not agree on leader P%d", leader)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// TestElection vérifie que le plus grand numéro de processus est élu, puis qu'une nouvelle élection désigne le plus
+// grand des processus restants lorsque le leader ne donne plus signe de vie.
+func TestElection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("election test skipped in short mode")
+	}
+	// Le plus grand numéro est au milieu de la ligne 0 - 3 - 1 - 2 pour que l'élection traverse tout le réseau
+	configuration := &types.ServerConfig{
+		Servers: map[int]types.Server{
+			0: {Characters: []string{"A-F"}, Address: "server-0"},
+			1: {Characters: []string{"G-M"}, Address: "server-1"},
+			2: {Characters: []string{"N-S"}, Address: "server-2"},
+			3: {Characters: []string{"T-Z"}, Address: "server-3"},
+		},
+		AdjacencyList: map[int][]int{0: {3}, 3: {0, 1}, 1: {3, 2}, 2: {1}},
+	}
+	servers, _ := startNetwork(t, configuration)
+
+	term := waitLeader(t, []*Server{servers[0], servers[1], servers[2], servers[3]}, 3)
+
+	servers[3].Close()
+	// Sans le leader, le réseau est coupé en deux : P0 reste seul et se désigne, P1 et P2 élisent P2
+	if next := waitLeader(t, []*Server{servers[1], servers[2]}, 2); next <= term {
+		t.Fatalf("election #%d after the leader stopped, want a term after #%d", next, term)
+	}
+	waitLeader(t, []*Server{servers[0]}, 0)
+}
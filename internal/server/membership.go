@@ -0,0 +1,314 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const (
+	gossipInterval    = time.Second            // Intervalle entre deux diffusions des membres connus aux voisins
+	joinRetryInterval = 500 * time.Millisecond // Délai avant de renvoyer une demande pour rejoindre le réseau restée sans réponse
+	maxJoinAttempts   = 20                     // Nombre maximal de demandes pour rejoindre le réseau avant abandon
+	leaveRepeats      = 3                      // Nombre d'envois de l'annonce de départ aux voisins, qui n'est pas acquittée
+)
+
+// membership représente la liste des membres du réseau connue par un serveur.
+//
+// Les serveurs de la configuration ne sont que des membres potentiels : un serveur démarré avec un membre à contacter
+// lui demande la liste des membres, puis se relie à ses voisins configurés qui sont membres. Chaque serveur diffuse
+// ensuite régulièrement sa liste à ses voisins, et l'état le plus récent d'un membre, selon son incarnation, remplace
+// les précédents. Un serveur qui quitte le réseau annonce son départ avec une incarnation plus grande.
+type membership struct {
+	mutex     sync.Mutex
+	adjacency []int                // Voisins configurés du serveur, qui ne sont ses voisins que s'ils sont membres
+	members   map[int]types.Member // État connu de chaque serveur, la clé est le numéro de processus
+	neighbors map[int]types.Server // Voisins configurés actuellement membres du réseau
+	joined    bool                 // Indique si le serveur fait partie du réseau
+}
+
+// newMembership crée la liste des membres d'un serveur. Un serveur qui doit rejoindre le réseau ne connaît que lui-même,
+// sinon les membres sont ceux de la configuration, ou tous les serveurs configurés si elle n'en précise pas.
+func newMembership(number int, configuration *types.ServerConfig, joining bool) *membership {
+	m := &membership{
+		adjacency: configuration.AdjacencyList[number],
+		members:   make(map[int]types.Member),
+		joined:    !joining,
+	}
+	if !joining {
+		initial := configuration.Members
+		if len(initial) == 0 {
+			for i := range configuration.Servers {
+				initial = append(initial, i)
+			}
+		}
+		for _, i := range initial {
+			m.members[i] = types.Member{Number: i}
+		}
+	}
+	m.neighbors = make(map[int]types.Server)
+	for _, i := range m.adjacency {
+		if _, ok := m.members[i]; ok && !joining {
+			m.neighbors[i] = configuration.Servers[i]
+		}
+	}
+	// L'incarnation d'un processus qui démarre est plus grande que celle de ses exécutions précédentes
+	m.members[number] = types.Member{Number: number, Incarnation: uint64(time.Now().UnixNano())}
+	return m
+}
+
+// neighbors retourne une copie des voisins actuels du serveur.
+func (s *Server) neighbors() map[int]types.Server {
+	m := s.membership
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	neighbors := make(map[int]types.Server, len(m.neighbors))
+	for i, neighbor := range m.neighbors {
+		neighbors[i] = neighbor
+	}
+	return neighbors
+}
+
+// neighbor retourne le voisin spécifié. Le booléen vaut false si le processus n'est pas un voisin actuel du serveur.
+func (s *Server) neighbor(number int) (types.Server, bool) {
+	m := s.membership
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	neighbor, ok := m.neighbors[number]
+	return neighbor, ok
+}
+
+// members retourne les numéros des membres actuels du réseau.
+func (s *Server) members() map[int]bool {
+	m := s.membership
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	members := make(map[int]bool)
+	for i, member := range m.members {
+		if !member.Left {
+			members[i] = true
+		}
+	}
+	return members
+}
+
+// memberList retourne l'état connu de chaque serveur, trié par numéro de processus. Le mutex doit être verrouillé par l'appelant.
+func (m *membership) memberList() []types.Member {
+	list := make([]types.Member, 0, len(m.members))
+	for _, member := range m.members {
+		list = append(list, member)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	return list
+}
+
+// updateNeighbors recalcule les voisins du serveur à partir de ses voisins configurés et des membres actuels, et met à
+// jour le détecteur de pannes. Le mutex doit être verrouillé par l'appelant.
+func (s *Server) updateNeighbors() {
+	m := s.membership
+	neighbors := make(map[int]types.Server)
+	if m.joined {
+		for _, i := range m.adjacency {
+			if member, ok := m.members[i]; ok && !member.Left {
+				neighbors[i] = s.Servers[i]
+			}
+		}
+	}
+
+	for i := range m.neighbors {
+		if _, ok := neighbors[i]; !ok {
+			s.detector.remove(i)
+			shared.Log(types.INFO, "P"+strconv.Itoa(i)+" is no longer a neighbor")
+		}
+	}
+	for i := range neighbors {
+		if _, ok := m.neighbors[i]; !ok {
+			s.detector.add(i)
+			shared.Log(types.INFO, "P"+strconv.Itoa(i)+" is now a neighbor")
+		}
+	}
+	m.neighbors = neighbors
+}
+
+// merge fusionne la liste des membres reçue avec la liste connue. L'état d'un serveur est remplacé par un état
+// d'incarnation plus grande, ou par un départ de même incarnation. Un serveur annoncé comme parti alors qu'il est
+// toujours actif reprend sa place avec une incarnation plus grande.
+func (s *Server) merge(members []types.Member) {
+	m := s.membership
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	changed := false
+	for _, member := range members {
+		if _, ok := s.Servers[member.Number]; !ok {
+			continue
+		}
+		known, ok := m.members[member.Number]
+		if ok && (member.Incarnation < known.Incarnation || (member.Incarnation == known.Incarnation && (known.Left || !member.Left))) {
+			continue
+		}
+
+		if member.Number == s.Number {
+			if member.Left && m.joined {
+				m.members[s.Number] = types.Member{Number: s.Number, Incarnation: member.Incarnation + 1}
+				shared.Log(types.WARNING, "Announced as gone by another process, refuting it")
+			}
+			continue
+		}
+
+		m.members[member.Number] = member
+		changed = true
+		if member.Left {
+			shared.Log(types.INFO, shared.ORANGE+"P"+strconv.Itoa(member.Number)+" left the network"+shared.RESET)
+		} else if !ok || known.Left {
+			shared.Log(types.INFO, shared.GREEN+"P"+strconv.Itoa(member.Number)+" joined the network"+shared.RESET)
+		}
+	}
+	if changed {
+		s.updateNeighbors()
+	}
+}
+
+// runGossip diffuse régulièrement la liste des membres connus aux voisins, jusqu'à l'arrêt du serveur.
+func (s *Server) runGossip() {
+	ticker := time.NewTicker(gossipInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.gossip()
+	}
+}
+
+// gossip envoie la liste des membres connus à tous les voisins.
+func (s *Server) gossip() {
+	m := s.membership
+	m.mutex.Lock()
+	message := types.MembershipMessage{Type: types.Gossip, Number: s.Number, Members: m.memberList()}
+	m.mutex.Unlock()
+
+	for i := range s.neighbors() {
+		if err := s.sendMembershipMessage(message, i); err != nil {
+			shared.Log(types.ERROR, err.Error())
+		}
+	}
+}
+
+// join demande la liste des membres au membre spécifié jusqu'à la réception de sa réponse. Le serveur se relie alors à
+// ses voisins configurés qui sont membres et leur annonce son arrivée.
+func (s *Server) join(contact int) {
+	m := s.membership
+	for attempt := 1; attempt <= maxJoinAttempts; attempt++ {
+		m.mutex.Lock()
+		joined := m.joined
+		message := types.MembershipMessage{Type: types.Join, Number: s.Number, Members: m.memberList()}
+		m.mutex.Unlock()
+		if joined {
+			return
+		}
+
+		shared.Log(types.INFO, "Asking P"+strconv.Itoa(contact)+" to join the network (attempt "+strconv.Itoa(attempt)+")")
+		if err := s.sendMembershipMessage(message, contact); err != nil {
+			shared.Log(types.ERROR, err.Error())
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(joinRetryInterval):
+		}
+	}
+	shared.Log(types.ERROR, "P"+strconv.Itoa(contact)+" never answered, could not join the network")
+}
+
+// Leave annonce le départ du serveur à ses voisins puis l'arrête. L'annonce n'étant pas acquittée, elle est envoyée
+// plusieurs fois. Les voisins qui ne la reçoivent pas apprennent le départ par la diffusion des membres des autres
+// voisins, ou détectent l'absence du serveur avec leur détecteur de pannes.
+func (s *Server) Leave() error {
+	m := s.membership
+	m.mutex.Lock()
+	own := m.members[s.Number]
+	m.members[s.Number] = types.Member{Number: s.Number, Incarnation: own.Incarnation + 1, Left: true}
+	m.mutex.Unlock()
+
+	shared.Log(types.INFO, "Leaving the network")
+	for i := 0; i < leaveRepeats; i++ {
+		s.gossip()
+		time.Sleep(joinRetryInterval / 5)
+	}
+	return s.Close()
+}
+
+// sendMembershipMessage envoie un message du protocole d'appartenance au serveur spécifié, hors de la couche de
+// livraison fiable.
+func (s *Server) sendMembershipMessage(message types.MembershipMessage, number int) error {
+	address := s.Servers[number].Address
+	data, err := s.seal(number, types.MembershipKind, "", message)
+	if err != nil {
+		return err
+	}
+	return s.send(address, data)
+}
+
+// handleMembershipMessage traite un message du protocole d'appartenance au réseau. Une demande pour rejoindre le réseau
+// reçoit en réponse la liste des membres, à l'adresse configurée du serveur qui la demande.
+func (s *Server) handleMembershipMessage(envelope *types.Envelope) error {
+	message, err := decodePayload[types.MembershipMessage](envelope)
+	if err != nil {
+		return err
+	}
+	if message.Type != types.Join && message.Type != types.Welcome && message.Type != types.Gossip {
+		return fmt.Errorf("invalid membership message type %q from P%d", message.Type, envelope.Sender)
+	}
+	_, ok := s.Servers[message.Number]
+	if !ok {
+		return fmt.Errorf("membership message from unknown server P%d", message.Number)
+	}
+
+	switch message.Type {
+	case types.Join:
+		s.merge(message.Members)
+		m := s.membership
+		m.mutex.Lock()
+		welcome := types.MembershipMessage{Type: types.Welcome, Number: s.Number, Members: m.memberList()}
+		m.mutex.Unlock()
+		if err := s.sendMembershipMessage(welcome, message.Number); err != nil {
+			shared.Log(types.ERROR, err.Error())
+		}
+	case types.Welcome:
+		m := s.membership
+		m.mutex.Lock()
+		if !m.joined {
+			m.joined = true
+			s.updateNeighbors()
+			shared.Log(types.INFO, shared.GREEN+"Joined the network through P"+strconv.Itoa(message.Number)+shared.RESET)
+		}
+		m.mutex.Unlock()
+		s.merge(message.Members)
+		s.gossip()
+	case types.Gossip:
+		s.merge(message.Members)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
+)
+
+// membershipConfiguration retourne la configuration d'un réseau de quatre serveurs en ligne dont seuls P0, P1 et P2
+// sont membres au démarrage.
+func membershipConfiguration() *types.ServerConfig {
+	return &types.ServerConfig{
+		Servers: map[int]types.Server{
+			0: {Characters: []string{"A-F"}, Address: "server-0"},
+			1: {Characters: []string{"G-M"}, Address: "server-1"},
+			2: {Characters: []string{"N-S"}, Address: "server-2"},
+			3: {Characters: []string{"T-Z"}, Address: "server-3"},
+		},
+		AdjacencyList: map[int][]int{0: {1}, 1: {0, 2}, 2: {1, 3}, 3: {2}},
+		Members:       []int{0, 1, 2},
+	}
+}
+
+// waitMembers attend que tous les serveurs spécifiés connaissent exactement les membres attendus.
+func waitMembers(t *testing.T, servers []*Server, members ...int) {
+	t.Helper()
+	want := make(map[int]bool)
+	for _, number := range members {
+		want[number] = true
+	}
+	for deadline := time.Now().Add(responseTimeout); ; time.Sleep(50 * time.Millisecond) {
+		agreed := true
+		for _, s := range servers {
+			agreed = agreed && reflect.DeepEqual(s.members(), want)
+		}
+		if agreed {
+			return
+		}
+		if time.Now().After(deadline) {
+			for _, s := range servers {
+				t.Logf("P%d knows members %v", s.Number, s.members())
+			}
+			t.Fatalf("servers do not agree on members %v", members)
+		}
+	}
+}
+
+// TestNewServerJoinRequiresMembers vérifie qu'un serveur ne peut rejoindre que le réseau d'une configuration listant
+// les membres initiaux dont il ne fait pas partie.
+func TestNewServerJoinRequiresMembers(t *testing.T) {
+	contact := 2
+	tests := []struct {
+		name    string
+		members []int
+		valid   bool
+	}{
+		{"initial members", []int{0, 1, 2}, true},
+		{"no members", nil, false},
+		{"joining server among the members", []int{0, 1, 2, 3}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configuration := membershipConfiguration()
+			configuration.Members = test.members
+			s, err := NewServer(3, configuration, &contact)
+			if (err == nil) != test.valid {
+				t.Fatalf("valid %t, want %t (%v)", err == nil, test.valid, err)
+			}
+			if s != nil {
+				s.Close()
+			}
+		})
+	}
+}
+
+// TestJoinAndLeave vérifie sur un réseau en mémoire que les serveurs absents de la liste des membres ne sont pas
+// attendus par l'algorithme ondulatoire, qu'un serveur qui rejoint le réseau est ajouté à ses comptages, puis qu'il en
+// est retiré lorsqu'il le quitte.
+func TestJoinAndLeave(t *testing.T) {
+	if testing.Short() {
+		t.Skip("network test skipped in short mode")
+	}
+	configuration := membershipConfiguration()
+	network := transport.NewMemoryNetwork()
+	var servers []*Server
+	for number := 0; number < 3; number++ {
+		servers = append(servers, startServer(t, network, configuration, number, nil))
+	}
+	client := listenClient(t, network)
+
+	text := "la pomme tombe"
+	counts := map[string]int{"A": 1, "B": 1, "E": 2, "L": 1, "M": 3, "O": 2, "P": 1}
+	for _, response := range wave(t, client, configuration, types.Command{Type: types.WaveCount, ID: "before", Text: text}, 0, 1, 2) {
+		checkResult(t, response, counts)
+	}
+
+	contact := 2
+	joining := startServer(t, network, configuration, 3, &contact)
+	waitMembers(t, append(servers, joining), 0, 1, 2, 3)
+	counts["T"] = 1
+	for _, response := range wave(t, client, configuration, types.Command{Type: types.WaveCount, ID: "joined", Text: text}, 0, 1, 2, 3) {
+		checkResult(t, response, counts)
+	}
+
+	if err := joining.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(t, servers, 0, 1, 2)
+	delete(counts, "T")
+	for _, response := range wave(t, client, configuration, types.Command{Type: types.WaveCount, ID: "left", Text: text}, 0, 1, 2) {
+		checkResult(t, response, counts)
+	}
+}
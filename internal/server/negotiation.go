@@ -0,0 +1,65 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/Lazzzer/labo4-sdr/internal/codec"
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// codecNegotiation choisit le codec des messages envoyés à chaque processus.
+//
+// Un serveur décode les messages de tous les codecs qu'il connaît, le codec d'un message étant reconnaissable à son
+// premier octet. Il n'envoie cependant son codec préféré à un processus qu'après avoir appris, par les signes de vie de
+// celui-ci, qu'il sait le décoder. Jusque-là, et pour les processus qui ne sont pas des voisins, le codec JSON est utilisé.
+type codecNegotiation struct {
+	mutex     sync.Mutex
+	preferred codec.Codec         // Codec préféré du serveur, selon sa configuration
+	peers     map[int]codec.Codec // Codec utilisé pour chaque processus dont les codecs sont connus
+}
+
+// newCodecNegotiation crée la négociation des codecs d'un serveur avec le codec préféré spécifié.
+func newCodecNegotiation(preferred codec.Codec) *codecNegotiation {
+	return &codecNegotiation{preferred: preferred, peers: make(map[int]codec.Codec)}
+}
+
+// forPeer retourne le codec à utiliser pour les messages envoyés au processus.
+func (n *codecNegotiation) forPeer(number int) codec.Codec {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if c, ok := n.peers[number]; ok {
+		return c
+	}
+	return codec.JSON
+}
+
+// learn enregistre les codecs que le processus sait décoder et choisit le codec préféré du serveur s'il en fait partie.
+func (n *codecNegotiation) learn(number int, supported []string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	chosen := codec.JSON
+	for _, name := range supported {
+		if name == n.preferred.Name() {
+			chosen = n.preferred
+		}
+	}
+	if previous, ok := n.peers[number]; !ok || previous != chosen {
+		n.peers[number] = chosen
+		if chosen != codec.JSON || ok {
+			shared.Log(types.INFO, "Using the "+chosen.Name()+" codec with P"+strconv.Itoa(number))
+		}
+	}
+}
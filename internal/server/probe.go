@@ -10,37 +10,138 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/Lazzzer/labo4-sdr/internal/shared"
 	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
 )
 
+const (
+	echoMargin       = 500 * time.Millisecond // Avance prise par chaque niveau de l'arbre sur l'échéance de son parent pour lui renvoyer un écho à temps
+	maxProbeAttempts = 3                      // Nombre maximal de tentatives de la racine pour atteindre les processus dont le chemin passait par un processus en panne
+)
+
 // initProbeEchoCountAsRoot initialise le traitement d'un texte avec l'algorithme sondes et échos en tant que processus racine.
 // La méthode retourne le résultat pour être traité comme réponse à la commande du client.
-func (s *Server) initProbeEchoCountAsRoot(text string) string {
-	<-emitterChan
-	emitterChan <- true // ainsi, dans le handle, le serveur saura qu'il a déjà émis et qu'il ne doit pas initier l'algorithme de nouveau
-
+// Le traitement doit déjà être marqué comme démarré, ainsi le serveur saura qu'il ne doit pas initier l'algorithme de nouveau.
+//
+// Lorsqu'un processus tombe en panne avant d'avoir envoyé son écho, les comptages de son sous-arbre sont perdus avec lui.
+// La racine sonde alors de nouveau le réseau en écartant les processus n'ayant pas répondu, ce qui permet d'atteindre
+// leur sous-arbre par d'autres chemins si le graphe le permet. Si des comptages manquent encore après maxProbeAttempts
+// tentatives ou à l'expiration du contexte, le résultat est marqué comme partiel avec la liste des processus manquants.
+//
+// Si la racine a mémorisé l'arbre couvrant d'un traitement précédent complet, le texte est d'abord diffusé le long de cet
+// arbre. Les sondes et échos ne sont utilisés que si un lien de l'arbre est rompu.
+func (s *Server) initProbeEchoCountAsRoot(ctx context.Context, c *computation, text string) string {
 	shared.Log(types.PROBE, "Processing text \""+text+"\" as root process")
 
-	s.init(false)
-	s.Parent = s.Number
-	s.Text = text
-	s.countLetterOccurrences(text)
+	c.init(false, s.neighbors())
+	c.Parent = s.Number
+	c.Text = text
+
+	first := 1
+	if tree, ok := s.trees.get(s.Number); ok {
+		if s.treeAttempt(ctx, c, tree) {
+			c.CachedTree = true
+		} else {
+			shared.Log(types.WARNING, "Cached spanning tree is broken, falling back to probes and echoes")
+			s.trees.remove(s.Number)
+			first = 2
+		}
+	}
+	if !c.CachedTree {
+		s.probeAttempts(ctx, c, first)
+	}
+	c.Partial = len(c.missingProcesses(s.members())) > 0
+
+	if c.Partial {
+		s.abortComputation(c)
+	} else {
+		shared.Log(types.INFO, shared.CYAN+"Counts: "+fmt.Sprint(c.Counts)+shared.RESET)
+		shared.Log(types.INFO, "Text \""+text+"\" has been processed")
+		c.FinishedAt = time.Now()
+		c.textProcessedChan <- true
+	}
+
+	result := s.result(c)
+	return s.response(result, "")
+}
+
+// probeAttempts effectue les tentatives de l'algorithme sondes et échos de la racine, à partir de la tentative spécifiée.
+// L'arbre couvrant d'une tentative complète sans processus écarté est mémorisé pour les traitements suivants.
+func (s *Server) probeAttempts(ctx context.Context, c *computation, first int) {
+	excluded := make(map[int]bool)
+	previous := 0
+	for attempt := first; ; attempt++ {
+		a := c
+		if attempt > 1 {
+			a = s.attemptComputation(c, attempt)
+		}
+		s.probeAttempt(ctx, a, excluded)
+		if a != c {
+			c.Counts, c.Known, c.Partial = a.Counts, a.Known, a.Partial
+			a.FinishedAt = time.Now()
+			a.textProcessedChan <- false
+		}
+
+		for _, number := range a.Unresponsive {
+			excluded[number] = true
+		}
+		c.Unresponsive = sortedProcesses(excluded)
+
+		missing := c.missingProcesses(s.members())
+		if len(missing) == 0 && len(excluded) == 0 {
+			s.trees.set(s.Number, spanningTree{Parent: s.Number, Children: sortedProcesses(a.Children)})
+		}
+		if len(missing) == 0 || ctx.Err() != nil || attempt-first+1 == maxProbeAttempts || len(c.Known) <= previous {
+			return
+		}
+		previous = len(c.Known)
+		// Une nouvelle tentative n'est utile que si des processus qui ne sont pas écartés manquent au résultat
+		recoverable := false
+		for _, number := range missing {
+			recoverable = recoverable || !excluded[number]
+		}
+		if !recoverable {
+			return
+		}
+		shared.Log(types.WARNING, "Missing counts from "+fmt.Sprint(missing)+", probing again without "+fmt.Sprint(c.Unresponsive))
+	}
+}
+
+// probeAttempt effectue une tentative de l'algorithme sondes et échos depuis la racine. Les processus écartés ne sont
+// ni sondés ni attendus par aucun processus de l'arbre.
+func (s *Server) probeAttempt(ctx context.Context, c *computation, excluded map[int]bool) {
+	c.Counts = make(types.ProcessCounts)
+	c.Known = map[int]bool{s.Number: true}
+	c.Children = make(map[int]bool)
+	c.Excluded = excluded
+	c.Partial = false
+	c.Unresponsive = nil
+	s.countCharacterOccurrences(c)
 
 	// Envoi des sondes aux voisins
 
 	message := types.ProbeEchoMessage{
-		Type:   types.Probe,
-		Number: s.Number,
-		Text:   &text,
-		Counts: nil,
+		Type:    types.Probe,
+		ID:      c.ID,
+		Number:  s.Number,
+		Text:    &c.Text,
+		Options: c.Options,
+		Counts:  nil,
+		Budget:  budgetOf(ctx),
+		Root:    s.Number,
+		Exclude: sortedProcesses(excluded),
 	}
 
-	for i, neighbor := range s.Neighbors {
-		err := sendMessage(message, neighbor)
+	for i := range s.aliveNeighbors() {
+		if excluded[i] {
+			continue
+		}
+		err := sendMessage(s, message, i)
 		if err != nil {
 			shared.Log(types.ERROR, err.Error())
 		}
@@ -50,106 +151,197 @@ func (s *Server) initProbeEchoCountAsRoot(text string) string {
 	// Attente des réponses des voisins et traitement des échos
 
 	shared.Log(types.ECHO, "Waiting echoes from children...")
-	for i := range s.Neighbors {
-		message := <-probeEchoMessageChans[i]
-		if message.Type == types.Echo {
-			shared.Log(types.ECHO, "Received echo from P"+strconv.Itoa(message.Number))
-			for letter, count := range *message.Counts {
-				s.Counts[letter] = count
-			}
-		}
-	}
+	s.collectEchoes(ctx, c)
+}
 
-	shared.Log(types.INFO, shared.CYAN+"Counts: "+fmt.Sprint(s.Counts)+shared.RESET)
-	shared.Log(types.INFO, "Text \""+text+"\" has been processed")
-	textProcessedChan <- true
-	<-emitterChan
-	emitterChan <- false
+// attemptComputation prépare le traitement d'une nouvelle tentative de la racine. Chaque tentative a son propre identifiant
+// afin que les processus y participent de nouveau sans confondre ses messages avec ceux des tentatives précédentes.
+func (s *Server) attemptComputation(c *computation, attempt int) *computation {
+	a := s.getComputation(c.ID + "/" + strconv.Itoa(attempt))
+	a.start()
+	s.computations.setLast(c.ID) // La tentative ne remplace pas le traitement demandé par le client comme dernier traitement
 
-	return s.displayOccurrences(s.Counts)
+	<-a.textProcessedChan
+	a.init(false, s.neighbors())
+	a.Parent = s.Number
+	a.Text = c.Text
+	a.Options = c.Options
+	return a
 }
 
-// initProbeEchoCountAsLeaf initialise le traitement d'un texte avec l'algorithme sondes et échos en tant que processus feuille.
-func (s *Server) initProbeEchoCountAsLeaf(message types.ProbeEchoMessage) {
-	<-textProcessedChan
+// initProbeEchoCountAsLeaf initialise le traitement d'un texte avec l'algorithme sondes et échos en tant que processus feuille,
+// à partir de la sonde reçue de son parent.
+// Le processus attend les échos de ses enfants jusqu'à l'échéance de son parent moins une marge, puis envoie son écho,
+// éventuellement partiel, à son parent.
+func (s *Server) initProbeEchoCountAsLeaf(c *computation, message types.ProbeEchoMessage) {
+	<-c.textProcessedChan
 
-	emitterChan <- true
+	c.init(false, s.neighbors())
 
-	s.init(false)
+	ctx, cancel := s.budgetContext(message.Budget)
+	defer cancel()
 
-	receivedMessage := <-probeEchoMessageChans[message.Number]
-	shared.Log(types.PROBE, "Received Probe from P"+strconv.Itoa(receivedMessage.Number))
-	shared.Log(types.PROBE, "Processing text \""+*receivedMessage.Text+"\" as leaf process")
+	shared.Log(types.PROBE, "Received Probe from P"+strconv.Itoa(message.Number))
+	shared.Log(types.PROBE, "Processing text \""+*message.Text+"\" as leaf process")
 
-	s.Text = *receivedMessage.Text
-	s.countLetterOccurrences(s.Text)
-	s.Parent = receivedMessage.Number
+	c.Text = *message.Text
+	c.Options = message.Options
+	s.countCharacterOccurrences(c)
+	c.Parent = message.Number
+	c.Known = map[int]bool{s.Number: true}
+	c.Excluded = make(map[int]bool)
+	for _, number := range message.Exclude {
+		c.Excluded[number] = true
+	}
 
 	// Envoi d'une sonde à tous les voisins sauf au parent
 
 	newMessage := types.ProbeEchoMessage{
-		Type:   types.Probe,
-		Number: s.Number,
-		Text:   &s.Text,
+		Type:    types.Probe,
+		ID:      c.ID,
+		Number:  s.Number,
+		Text:    &c.Text,
+		Options: c.Options,
+		Budget:  budgetOf(ctx),
+		Root:    message.Root,
+		Exclude: message.Exclude,
 	}
 
-	for i := range s.Neighbors {
-		if i != s.Parent {
-			sendMessage(newMessage, s.Neighbors[i])
+	for i := range s.aliveNeighbors() {
+		if i != c.Parent && !c.Excluded[i] {
+			sendMessage(s, newMessage, i)
 			shared.Log(types.PROBE, "Sent probe to P"+strconv.Itoa(i))
 		}
 	}
 
 	// Attente des réponses des voisins et traitement des échos
 
-	for i := range s.Neighbors {
-		if i == s.Parent {
+	s.collectEchoes(ctx, c)
+	if c.Partial {
+		shared.Log(types.ERROR, "Deadline reached, sending partial echo to P"+strconv.Itoa(c.Parent))
+		s.trees.remove(message.Root)
+	} else {
+		s.trees.set(message.Root, spanningTree{Parent: c.Parent, Children: sortedProcesses(c.Children)})
+	}
+
+	// Envoi de l'écho au parent
+
+	newMessage = types.ProbeEchoMessage{
+		Type:         types.Echo,
+		ID:           c.ID,
+		Number:       s.Number,
+		Counts:       &c.Counts,
+		Known:        c.knownProcesses(),
+		Unresponsive: c.Unresponsive,
+	}
+	sendMessage(s, newMessage, c.Parent)
+	shared.Log(types.ECHO, "Sent echo to P"+strconv.Itoa(c.Parent))
+
+	shared.Log(types.INFO, shared.CYAN+"Counts: "+fmt.Sprint(c.Counts)+shared.RESET)
+	shared.Log(types.INFO, "Processed text \""+c.Text+"\" as leaf process, root process can now display the result")
+	c.FinishedAt = time.Now()
+	c.textProcessedChan <- false // Les serveurs feuilles ne peuvent pas répondre à des asks car leur map de comptage n'est pas complète
+}
+
+// collectEchoes attend un message de chaque voisin autre que le parent et fusionne les comptages des échos reçus.
+// Les voisins n'ayant pas répondu avant l'expiration du contexte ou suspectés d'être en panne par le détecteur de pannes
+// sont ajoutés aux processus injoignables, ainsi que ceux signalés dans les échos partiels reçus. Les voisins écartés
+// par la racine ne sont pas attendus.
+func (s *Server) collectEchoes(ctx context.Context, c *computation) {
+	for i := range s.neighbors() {
+		if i == c.Parent || c.Excluded[i] {
 			continue
 		}
-		message := <-probeEchoMessageChans[i]
-		if message.Type == types.Echo {
+		message, ok := receiveFrom(ctx, c.probeEchoMessages(i), s.detector.suspicion(i))
+		if !ok {
+			if ctx.Err() == nil {
+				shared.Log(types.ECHO, "P"+strconv.Itoa(i)+" is suspected to have crashed, not waiting for its echo")
+			} else {
+				shared.Log(types.ECHO, "No answer from P"+strconv.Itoa(i)+" before the deadline")
+			}
+			c.Partial = true
+			c.Unresponsive = append(c.Unresponsive, i)
+			continue
+		}
+		if message.Type == types.Echo && message.Counts != nil {
 			shared.Log(types.ECHO, "Received echo from P"+strconv.Itoa(i))
-			for letter, count := range *message.Counts {
-				s.Counts[letter] = count
+			c.Children[i] = true
+			c.mergeCounts(*message.Counts)
+			for _, number := range message.Known {
+				c.Known[number] = true
+			}
+			if len(message.Unresponsive) > 0 {
+				c.Partial = true
+				c.Unresponsive = append(c.Unresponsive, message.Unresponsive...)
 			}
 		} else {
 			shared.Log(types.PROBE, "Received probe from P"+strconv.Itoa(i)+", not handling it")
 		}
 	}
+}
 
-	// Envoi de l'écho au parent
+// budgetContext retourne le contexte du traitement d'un processus feuille à partir du temps restant à son parent lors
+// de l'envoi de la sonde. Il expire une marge avant ce temps, mesuré sur l'horloge locale depuis la réception de la
+// sonde, ce qui ne suppose pas d'horloges synchronisées. Sans temps transmis, la durée maximale d'un traitement s'applique.
+func (s *Server) budgetContext(budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget == 0 {
+		return s.computationContext()
+	}
+	return context.WithTimeout(s.ctx, budget-echoMargin)
+}
 
-	newMessage = types.ProbeEchoMessage{
-		Type:   types.Echo,
-		Number: s.Number,
-		Counts: &s.Counts,
-	}
-	sendMessage(newMessage, s.Neighbors[s.Parent])
-	shared.Log(types.ECHO, "Sent echo to P"+strconv.Itoa(s.Parent))
-
-	shared.Log(types.INFO, shared.CYAN+"Counts: "+fmt.Sprint(s.Counts)+shared.RESET)
-	shared.Log(types.INFO, "Processed text \""+s.Text+"\" as leaf process, root process can now display the result")
-	textProcessedChan <- false // Les serveurs feuilles ne peuvent pas répondre à des asks car leur map de comptage n'est pas complète
-	<-emitterChan
-	emitterChan <- false
+// budgetOf retourne le temps restant avant l'échéance du contexte, au moins une nanoseconde pour qu'une échéance
+// dépassée ne soit pas confondue avec une absence d'échéance, ou 0 s'il n'en a pas.
+func budgetOf(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(deadline); remaining > 0 {
+		return remaining
+	}
+	return time.Nanosecond
 }
 
-// handleProbeEchoMessage traite un message de type Probe ou Echo.
-// Si le serveur n'a pas encore émis, il initie l'algorithme en tant que processus feuille dans une goroutine.
-func (s *Server) handleProbeEchoMessage(messageStr string) error {
-	message, err := shared.Parse[types.ProbeEchoMessage](messageStr)
-	if err == nil {
-		if message.Type == types.Probe || message.Type == types.Echo {
-			go func() {
-				probeEchoMessageChans[message.Number] <- *message
-			}()
-			if <-emitterChan {
-				emitterChan <- true // si le serveur a déjà émis, il ne doit pas initier l'algorithme de nouveau
-				return nil
-			}
-			go s.initProbeEchoCountAsLeaf(*message)
+// handleProbeEchoMessage traite un message de type Probe, Echo, Broadcast ou Convergecast.
+// Si le serveur n'a pas encore émis pour le traitement d'une sonde ou d'une diffusion, il initie l'algorithme en tant que
+// processus feuille dans une goroutine. Un écho ou une remontée n'est accepté que pour un traitement en cours, un
+// message arrivé après la fin de son traitement ou son oubli est refusé.
+func (s *Server) handleProbeEchoMessage(envelope *types.Envelope) error {
+	message, err := decodePayload[types.ProbeEchoMessage](envelope)
+	if err != nil {
+		return err
+	}
+	if message.ID == "" {
+		return fmt.Errorf("%s message from P%d has no computation ID", message.Type, envelope.Sender)
+	}
+
+	switch message.Type {
+	case types.Probe, types.Broadcast:
+		if message.Text == nil {
+			return fmt.Errorf("%s message from P%d has no text", message.Type, envelope.Sender)
+		}
+		c := s.getComputation(message.ID)
+		if !c.start() {
+			c.probeEchoMessages(message.Number).put(*message) // si le serveur a déjà émis, il ne doit pas initier l'algorithme de nouveau
 			return nil
 		}
+		if message.Type == types.Broadcast {
+			go s.initTreeCountAsLeaf(c, *message)
+		} else {
+			go s.initProbeEchoCountAsLeaf(c, *message)
+		}
+		return nil
+	case types.Echo, types.Convergecast:
+		if message.Counts == nil {
+			return fmt.Errorf("%s message from P%d has no counts", message.Type, envelope.Sender)
+		}
+		c, ok := s.findComputation(message.ID)
+		if !ok || c.isIdle() {
+			return fmt.Errorf("%s message from P%d for computation %s which is not in progress", message.Type, envelope.Sender, message.ID)
+		}
+		c.probeEchoMessages(message.Number).put(*message)
+		return nil
 	}
-	return fmt.Errorf("invalid message type")
+	return fmt.Errorf("invalid probe-echo message type %q from P%d", message.Type, envelope.Sender)
 }
@@ -0,0 +1,102 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/codec"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// probeEchoEnvelope retourne l'enveloppe d'un message sondes et échos envoyé par son émetteur.
+func probeEchoEnvelope(t *testing.T, message types.ProbeEchoMessage) *types.Envelope {
+	t.Helper()
+	payload, err := codec.JSON.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &types.Envelope{Kind: types.ProbeEchoKind, Version: types.ProtocolVersion, Sender: message.Number, Payload: payload}
+}
+
+// TestHandleProbeEchoMessageRejectsInvalidMessages vérifie qu'un message incomplet ou un écho d'un traitement inconnu
+// est refusé sans démarrer de traitement.
+func TestHandleProbeEchoMessageRejectsInvalidMessages(t *testing.T) {
+	text := "hello"
+	counts := types.ProcessCounts{}
+
+	tests := []struct {
+		name    string
+		message types.ProbeEchoMessage
+	}{
+		{"probe without text", types.ProbeEchoMessage{Type: types.Probe, ID: "a", Number: 1}},
+		{"broadcast without text", types.ProbeEchoMessage{Type: types.Broadcast, ID: "a", Number: 1}},
+		{"echo without counts", types.ProbeEchoMessage{Type: types.Echo, ID: "a", Number: 1}},
+		{"convergecast without counts", types.ProbeEchoMessage{Type: types.Convergecast, ID: "a", Number: 1}},
+		{"echo for unknown computation", types.ProbeEchoMessage{Type: types.Echo, ID: "a", Number: 1, Text: &text, Counts: &counts}},
+		{"convergecast for unknown computation", types.ProbeEchoMessage{Type: types.Convergecast, ID: "a", Number: 1, Counts: &counts}},
+		{"probe without ID", types.ProbeEchoMessage{Type: types.Probe, Number: 1, Text: &text}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, 0)
+			if err := s.handleProbeEchoMessage(probeEchoEnvelope(t, test.message)); err == nil {
+				t.Fatal("message accepted")
+			}
+			if _, ok := s.findComputation("a"); ok {
+				t.Fatal("computation created for a rejected message")
+			}
+		})
+	}
+}
+
+// TestHandleProbeEchoMessageRejectsLateEcho vérifie qu'un écho d'un traitement terminé est refusé.
+func TestHandleProbeEchoMessageRejectsLateEcho(t *testing.T) {
+	s := newTestServer(t, 0)
+	s.getComputation("a")
+
+	counts := types.ProcessCounts{}
+	message := types.ProbeEchoMessage{Type: types.Echo, ID: "a", Number: 1, Counts: &counts}
+	if err := s.handleProbeEchoMessage(probeEchoEnvelope(t, message)); err == nil {
+		t.Fatal("late echo accepted")
+	}
+}
+
+// TestBudgetContext vérifie que l'échéance d'une feuille est calculée sur son horloge à partir du temps restant à son
+// parent, quelle que soit l'heure de l'horloge du parent.
+func TestBudgetContext(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	parent, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	budget := budgetOf(parent)
+	if budget <= 4*time.Second || budget > 5*time.Second {
+		t.Fatalf("budget %v, want about 5s", budget)
+	}
+
+	start := time.Now()
+	ctx, cancel := s.budgetContext(budget)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if want := start.Add(budget - echoMargin); !ok || deadline.Before(want) || deadline.After(want.Add(time.Second)) {
+		t.Fatalf("leaf deadline %v, want %v", deadline, want)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if budget := budgetOf(expired); budget != time.Nanosecond {
+		t.Fatalf("budget %v of an expired context, want 1ns", budget)
+	}
+	if budget := budgetOf(context.Background()); budget != 0 {
+		t.Fatalf("budget %v of a context without deadline, want 0", budget)
+	}
+	ctx, cancel = s.budgetContext(0)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || deadline.Before(start.Add(s.ComputationTimeout-time.Second)) {
+		t.Fatalf("leaf deadline %v without budget, want the computation timeout", deadline)
+	}
+}
@@ -0,0 +1,384 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const (
+	initialAckTimeout  = 200 * time.Millisecond // Délai d'attente d'un acquittement avant la première retransmission
+	maxAckTimeout      = 3 * time.Second        // Délai d'attente maximal entre deux retransmissions
+	maxRetransmissions = 20                     // Nombre maximal de retransmissions d'un message avant abandon
+	maxBufferedAhead   = 256                    // Nombre de numéros de séquence en avance qu'un voisin peut faire mettre de côté
+)
+
+// reception est le résultat de l'enregistrement d'un message de données reçu.
+type reception int
+
+const (
+	accepted  reception = iota // Message nouveau, mis de côté ou livré, qui doit être acquitté
+	duplicate                  // Message déjà reçu, qui doit être acquitté de nouveau car l'acquittement précédent a pu être perdu
+	refused                    // Message d'une ancienne époque ou trop en avance, qui n'est pas acquitté
+)
+
+// reliableLayer gère la livraison fiable des messages entre serveurs par-dessus le transport.
+// Chaque lien vers un voisin possède ses propres numéros de séquence. Les messages de données sont retransmis avec
+// un délai croissant tant qu'ils ne sont pas acquittés et les doublons sont écartés à la réception.
+//
+// Chaque message de données indique aussi le plus petit numéro de séquence que l'émetteur attend encore de voir
+// acquitté. Les numéros précédents ont été reçus ou abandonnés, ce qui permet au destinataire de sauter les messages
+// abandonnés et de se synchroniser sur l'émetteur après son propre redémarrage, sans attendre des messages qui ne
+// viendront plus. Lorsqu'un voisin redémarre, les messages qui lui étaient destinés sont abandonnés.
+type reliableLayer struct {
+	mutex    sync.Mutex
+	epoch    int64                        // Époque du processus, permet aux voisins de détecter un redémarrage
+	nextSeq  map[int]uint64               // Prochain numéro de séquence à utiliser pour chaque voisin
+	pending  map[int]map[uint64]chan bool // Messages en attente d'acquittement pour chaque voisin, le channel est fermé à l'acquittement ou à l'abandon
+	received map[int]*receptionState      // État de réception pour chaque voisin
+	peers    map[int]int64                // Dernière époque connue de chaque voisin, d'après les enveloppes reçues
+}
+
+// receptionState représente l'état de réception des messages d'un voisin pour une époque donnée.
+// Les messages arrivés en avance sont mis de côté afin d'être livrés dans l'ordre d'émission.
+type receptionState struct {
+	epoch    int64             // Époque du voisin
+	expected uint64            // Prochain numéro de séquence à livrer
+	buffered map[uint64][]byte // Messages reçus en avance, indexés par numéro de séquence
+}
+
+// newReliableLayer crée une couche de livraison fiable vide avec une nouvelle époque.
+func newReliableLayer() *reliableLayer {
+	return &reliableLayer{
+		epoch:    time.Now().UnixNano(),
+		nextSeq:  make(map[int]uint64),
+		pending:  make(map[int]map[uint64]chan bool),
+		received: make(map[int]*receptionState),
+		peers:    make(map[int]int64),
+	}
+}
+
+// sendMessage est une fonction générique permettant d'envoyer un message de type T à un voisin du réseau.
+// Le message peut être de type WaveMessage, ProbeEchoMessage ou ElectionMessage. Il est placé dans une enveloppe de la
+// sorte correspondante et transmis par la couche de livraison fiable qui se charge de le retransmettre jusqu'à son acquittement.
+func sendMessage[T types.WaveMessage | types.ProbeEchoMessage | types.ElectionMessage](s *Server, message T, number int) error {
+	var kind types.MessageKind
+	var computation string
+	switch m := any(message).(type) {
+	case types.WaveMessage:
+		kind, computation = types.WaveKind, m.ID
+	case types.ProbeEchoMessage:
+		kind, computation = types.ProbeEchoKind, m.ID
+	case types.ElectionMessage:
+		kind = types.ElectionKind
+	}
+
+	payload, err := s.seal(number, kind, computation, message)
+	if err != nil {
+		shared.Log(types.ERROR, err.Error())
+		return err
+	}
+
+	return s.sendReliable(number, payload)
+}
+
+// sendDatagram place le message dans une enveloppe de la sorte spécifiée, l'encapsule dans un datagramme et l'envoie
+// au voisin sans attendre d'acquittement. Un datagramme perdu n'est pas retransmis et les datagrammes ne sont pas
+// ordonnés, ce qui convient aux messages périodiques.
+func (s *Server) sendDatagram(number int, kind types.MessageKind, message any) error {
+	neighbor, ok := s.neighbor(number)
+	if !ok {
+		return fmt.Errorf("P%d is not a neighbor", number)
+	}
+
+	payload, err := s.seal(number, kind, "", message)
+	if err != nil {
+		return err
+	}
+	data, err := s.seal(number, types.ReliableKind, "", types.ReliableMessage{
+		Type:    types.Datagram,
+		Number:  s.Number,
+		Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+	return s.send(neighbor.Address, data)
+}
+
+// sendReliable encapsule l'enveloppe dans un message de données numéroté et l'envoie au voisin.
+// Une goroutine retransmet ensuite le message avec un délai doublant à chaque tentative jusqu'à la réception de l'acquittement.
+// Le numéro de séquence n'est consommé que si le message a pu être scellé, afin de ne pas laisser de trou dans la séquence.
+func (s *Server) sendReliable(number int, payload []byte) error {
+	neighbor, ok := s.neighbor(number)
+	if !ok {
+		return fmt.Errorf("P%d is not a neighbor", number)
+	}
+
+	reliable := s.reliable
+	reliable.mutex.Lock()
+	message := types.ReliableMessage{
+		Type:    types.Data,
+		Number:  s.Number,
+		Epoch:   reliable.epoch,
+		Seq:     reliable.nextSeq[number],
+		Base:    reliable.base(number),
+		Payload: payload,
+	}
+	data, err := s.seal(number, types.ReliableKind, "", message)
+	if err != nil {
+		reliable.mutex.Unlock()
+		return err
+	}
+	seq := message.Seq
+	reliable.nextSeq[number]++
+	acked := make(chan bool)
+	if reliable.pending[number] == nil {
+		reliable.pending[number] = make(map[uint64]chan bool)
+	}
+	reliable.pending[number][seq] = acked
+	reliable.mutex.Unlock()
+
+	err = s.send(neighbor.Address, data)
+
+	go func() {
+		timeout := initialAckTimeout
+		for attempt := 1; attempt <= maxRetransmissions; attempt++ {
+			select {
+			case <-acked:
+				return
+			case <-s.ctx.Done():
+				return
+			case <-time.After(timeout):
+			}
+
+			shared.Log(types.DEBUG, "No ack from P"+strconv.Itoa(number)+" for message #"+strconv.FormatUint(seq, 10)+", retransmitting (attempt "+strconv.Itoa(attempt)+")")
+			// Le message est scellé de nouveau, sans quoi le destinataire l'écarterait comme rejoué
+			reliable.mutex.Lock()
+			message.Base = reliable.base(number)
+			reliable.mutex.Unlock()
+			data, err := s.seal(number, types.ReliableKind, "", message)
+			if err == nil {
+				err = s.send(neighbor.Address, data)
+			}
+			if err != nil {
+				shared.Log(types.ERROR, err.Error())
+			}
+
+			timeout *= 2
+			if timeout > maxAckTimeout {
+				timeout = maxAckTimeout
+			}
+		}
+
+		select {
+		case <-acked:
+		case <-s.ctx.Done():
+		case <-time.After(timeout):
+			shared.Log(types.ERROR, "Message #"+strconv.FormatUint(seq, 10)+" to P"+strconv.Itoa(number)+" was never acknowledged, giving up")
+			reliable.mutex.Lock()
+			delete(reliable.pending[number], seq)
+			reliable.mutex.Unlock()
+		}
+	}()
+
+	return err
+}
+
+// base retourne le plus petit numéro de séquence envoyé au voisin qui est encore en attente d'acquittement, ou le
+// prochain numéro de séquence si aucun message n'est en attente. Le mutex doit être verrouillé par l'appelant.
+func (r *reliableLayer) base(number int) uint64 {
+	base := r.nextSeq[number]
+	for seq := range r.pending[number] {
+		if seq < base {
+			base = seq
+		}
+	}
+	return base
+}
+
+// restarted enregistre l'époque d'une enveloppe reçue du voisin. Si elle est plus récente que la dernière connue, le
+// voisin a redémarré et a perdu son état de réception, les messages qui lui étaient destinés sont alors abandonnés.
+// La méthode retourne le nombre de messages abandonnés.
+func (r *reliableLayer) restarted(number int, epoch int64) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	known, ok := r.peers[number]
+	if ok && epoch <= known {
+		return 0
+	}
+	r.peers[number] = epoch
+	if !ok {
+		return 0
+	}
+
+	abandoned := len(r.pending[number])
+	for seq, acked := range r.pending[number] {
+		close(acked)
+		delete(r.pending[number], seq)
+	}
+	return abandoned
+}
+
+// handleReliableMessage traite un message de la couche de livraison fiable.
+// Un acquittement libère la retransmission du message correspondant. Un message de données est acquitté dès qu'il est
+// mis de côté ou livré, son contenu n'étant transmis aux algorithmes qu'une seule fois et dans l'ordre d'émission.
+// Un message qui ne peut pas être mis de côté n'est pas acquitté et sera retransmis.
+func (s *Server) handleReliableMessage(envelope *types.Envelope) error {
+	message, err := decodePayload[types.ReliableMessage](envelope)
+	if err != nil {
+		return err
+	}
+	if message.Type != types.Data && message.Type != types.Ack && message.Type != types.Datagram {
+		return fmt.Errorf("invalid reliable message type %q from P%d", message.Type, envelope.Sender)
+	}
+
+	neighbor, ok := s.neighbor(message.Number)
+	if !ok {
+		return fmt.Errorf("reliable message from unknown neighbor P%d", message.Number)
+	}
+	s.detector.heard(message.Number)
+	if abandoned := s.reliable.restarted(message.Number, envelope.Epoch); abandoned > 0 {
+		shared.Log(types.WARNING, "P"+strconv.Itoa(message.Number)+" restarted, abandoning "+strconv.Itoa(abandoned)+" messages sent to its previous run")
+	}
+
+	if message.Type == types.Datagram {
+		s.deliver(message.Number, message.Payload)
+		return nil
+	}
+
+	reliable := s.reliable
+	if message.Type == types.Ack {
+		reliable.mutex.Lock()
+		if acked, ok := reliable.pending[message.Number][message.Seq]; ok && message.Epoch == reliable.epoch {
+			close(acked)
+			delete(reliable.pending[message.Number], message.Seq)
+		}
+		reliable.mutex.Unlock()
+		return nil
+	}
+
+	payloads, result := reliable.receive(message.Number, message.Epoch, message.Seq, message.Base, message.Payload)
+	switch result {
+	case refused:
+		shared.Log(types.DEBUG, "Message #"+strconv.FormatUint(message.Seq, 10)+" from P"+strconv.Itoa(message.Number)+" cannot be buffered, not acknowledging it")
+	case duplicate:
+		shared.Log(types.DEBUG, "Duplicate message #"+strconv.FormatUint(message.Seq, 10)+" from P"+strconv.Itoa(message.Number)+" discarded")
+		s.sendAck(message, neighbor.Address)
+	default:
+		s.sendAck(message, neighbor.Address)
+	}
+
+	for _, payload := range payloads {
+		s.deliver(message.Number, payload)
+	}
+	return nil
+}
+
+// deliver transmet l'enveloppe contenue dans un message reçu d'un voisin au répartiteur, qui la transmet à l'algorithme
+// auquel elle est destinée. Seuls les messages des algorithmes peuvent être transportés par la couche de livraison fiable.
+func (s *Server) deliver(number int, payload []byte) {
+	envelope, err := open(payload)
+	if err == nil && (envelope.Kind == types.MembershipKind || envelope.Kind == types.ReliableKind || envelope.Kind == types.ChallengeKind) {
+		err = fmt.Errorf("%s message cannot be carried by the reliable layer", envelope.Kind)
+	}
+	if err == nil && envelope.Sender != number {
+		err = fmt.Errorf("spoofed sender, %s message from P%d claims to come from P%d", envelope.Kind, number, envelope.Sender)
+	}
+	if err == nil {
+		err = s.dispatcher.dispatch(envelope)
+	}
+	if err != nil {
+		shared.Log(types.ERROR, "Payload from P"+strconv.Itoa(number)+" rejected: "+err.Error())
+	}
+}
+
+// sendAck acquitte un message de données auprès du voisin qui l'a émis.
+func (s *Server) sendAck(message *types.ReliableMessage, address string) {
+	ack, err := s.seal(message.Number, types.ReliableKind, "", types.ReliableMessage{
+		Type:   types.Ack,
+		Number: s.Number,
+		Epoch:  message.Epoch,
+		Seq:    message.Seq,
+	})
+	if err != nil {
+		shared.Log(types.ERROR, err.Error())
+		return
+	}
+	if err := s.send(address, ack); err != nil {
+		shared.Log(types.ERROR, err.Error())
+	}
+}
+
+// receive enregistre un message de données d'un voisin et retourne les contenus pouvant être livrés dans l'ordre, ainsi
+// que le résultat de l'enregistrement. Un changement d'époque signifie que le voisin a redémarré, son état de réception
+// est alors réinitialisé. Le numéro de base du message indique que les numéros précédents ne seront plus retransmis :
+// un état de réception nouveau commence à ce numéro, et un état en retard livre les messages mis de côté qui précèdent
+// ce numéro en sautant ceux qui ont été abandonnés. Un message trop en avance sur le prochain numéro attendu est refusé
+// afin de borner les messages mis de côté.
+func (r *reliableLayer) receive(number int, epoch int64, seq uint64, base uint64, payload []byte) ([][]byte, reception) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	state, ok := r.received[number]
+	if ok && epoch < state.epoch {
+		return nil, refused
+	}
+	if !ok || epoch > state.epoch {
+		state = &receptionState{epoch: epoch, expected: base, buffered: make(map[uint64][]byte)}
+		r.received[number] = state
+	}
+
+	var payloads [][]byte
+	if base > state.expected {
+		var skipped []uint64
+		for buffered := range state.buffered {
+			if buffered < base {
+				skipped = append(skipped, buffered)
+			}
+		}
+		sort.Slice(skipped, func(i, j int) bool { return skipped[i] < skipped[j] })
+		for _, buffered := range skipped {
+			payloads = append(payloads, state.buffered[buffered])
+			delete(state.buffered, buffered)
+		}
+		state.expected = base
+	}
+
+	if seq < state.expected {
+		return payloads, duplicate
+	}
+	if _, ok := state.buffered[seq]; ok {
+		return payloads, duplicate
+	}
+	if seq-state.expected >= maxBufferedAhead {
+		return payloads, refused
+	}
+
+	state.buffered[seq] = payload
+	for {
+		next, ok := state.buffered[state.expected]
+		if !ok {
+			break
+		}
+		payloads = append(payloads, next)
+		delete(state.buffered, state.expected)
+		state.expected++
+	}
+	return payloads, accepted
+}
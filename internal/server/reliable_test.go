@@ -0,0 +1,138 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+// dataMessage représente un message de données reçu par la couche de livraison fiable dans les tests.
+type dataMessage struct {
+	epoch int64
+	seq   uint64
+	base  uint64
+}
+
+// TestReliableLayerReceive vérifie l'ordre de livraison des messages de données d'un voisin et leur acquittement.
+func TestReliableLayerReceive(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  []dataMessage
+		delivered []uint64  // Numéros de séquence livrés, dans l'ordre
+		last      reception // Résultat de l'enregistrement du dernier message
+	}{
+		{
+			name:      "in order",
+			messages:  []dataMessage{{1, 0, 0}, {1, 1, 0}, {1, 2, 1}},
+			delivered: []uint64{0, 1, 2},
+			last:      accepted,
+		},
+		{
+			name:      "out of order",
+			messages:  []dataMessage{{1, 1, 0}, {1, 2, 0}, {1, 0, 0}},
+			delivered: []uint64{0, 1, 2},
+			last:      accepted,
+		},
+		{
+			name:      "duplicate",
+			messages:  []dataMessage{{1, 0, 0}, {1, 0, 0}},
+			delivered: []uint64{0},
+			last:      duplicate,
+		},
+		{
+			name:      "receiver restarted while the sender continues its sequence",
+			messages:  []dataMessage{{1, 57, 57}, {1, 58, 57}},
+			delivered: []uint64{57, 58},
+			last:      accepted,
+		},
+		{
+			name:      "first message received out of order after a restart",
+			messages:  []dataMessage{{1, 58, 57}, {1, 57, 57}},
+			delivered: []uint64{57, 58},
+			last:      accepted,
+		},
+		{
+			name:      "abandoned message is skipped",
+			messages:  []dataMessage{{1, 0, 0}, {1, 2, 1}, {1, 3, 2}},
+			delivered: []uint64{0, 2, 3},
+			last:      accepted,
+		},
+		{
+			name:      "message abandoned after the next one was buffered",
+			messages:  []dataMessage{{1, 2, 1}, {1, 3, 3}},
+			delivered: []uint64{2, 3},
+			last:      accepted,
+		},
+		{
+			name:      "message too far ahead",
+			messages:  []dataMessage{{1, 0, 0}, {1, maxBufferedAhead + 1, 1}},
+			delivered: []uint64{0},
+			last:      refused,
+		},
+		{
+			name:      "sender restarted",
+			messages:  []dataMessage{{1, 0, 0}, {1, 1, 0}, {2, 0, 0}},
+			delivered: []uint64{0, 1, 0},
+			last:      accepted,
+		},
+		{
+			name:      "message from a previous run of the sender",
+			messages:  []dataMessage{{2, 0, 0}, {1, 1, 0}},
+			delivered: []uint64{0},
+			last:      refused,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newReliableLayer()
+			var delivered []uint64
+			var last reception
+			for _, m := range test.messages {
+				payloads, result := r.receive(1, m.epoch, m.seq, m.base, []byte{byte(m.seq)})
+				for _, payload := range payloads {
+					delivered = append(delivered, uint64(payload[0]))
+				}
+				last = result
+			}
+			if !reflect.DeepEqual(delivered, test.delivered) {
+				t.Errorf("delivered %v, want %v", delivered, test.delivered)
+			}
+			if last != test.last {
+				t.Errorf("last reception %d, want %d", last, test.last)
+			}
+		})
+	}
+}
+
+// TestReliableLayerRestarted vérifie que les messages en attente d'acquittement sont abandonnés au redémarrage du voisin.
+func TestReliableLayerRestarted(t *testing.T) {
+	r := newReliableLayer()
+	if abandoned := r.restarted(1, 10); abandoned != 0 {
+		t.Fatalf("%d messages abandoned on the first contact", abandoned)
+	}
+
+	acked := make(chan bool)
+	r.nextSeq[1] = 4
+	r.pending[1] = map[uint64]chan bool{3: acked}
+	if base := r.base(1); base != 3 {
+		t.Fatalf("base %d, want 3", base)
+	}
+	if abandoned := r.restarted(1, 10); abandoned != 0 {
+		t.Fatalf("%d messages abandoned without a restart", abandoned)
+	}
+
+	if abandoned := r.restarted(1, 11); abandoned != 1 {
+		t.Fatalf("%d messages abandoned, want 1", abandoned)
+	}
+	select {
+	case <-acked:
+	default:
+		t.Fatal("retransmission of the abandoned message not stopped")
+	}
+	if base := r.base(1); base != 4 {
+		t.Fatalf("base %d, want 4", base)
+	}
+}
@@ -0,0 +1,285 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// replayWindowSize est le nombre de compteurs précédant le plus grand compteur reçu d'un processus qui sont encore
+// acceptés, ce qui tolère les datagrammes arrivés dans le désordre.
+const replayWindowSize = 64
+
+const (
+	nonceSize         = 16                     // Taille en octets du nonce d'un défi
+	challengeInterval = 200 * time.Millisecond // Délai minimal entre deux défis envoyés à un même processus
+)
+
+// replayGuard numérote les enveloppes envoyées et écarte les enveloppes reçues rejouées.
+//
+// Chaque enveloppe porte l'époque de son émetteur, qui change à chaque démarrage du processus, et un compteur
+// croissant propre au destinataire. Le destinataire retient pour chaque émetteur la plus grande époque et le plus
+// grand compteur reçus, ainsi que les compteurs déjà reçus parmi les précédents. Une enveloppe d'une ancienne époque,
+// déjà reçue ou trop ancienne est refusée. L'époque et le compteur étant couverts par le code d'authentification, un
+// message intercepté ne peut pas être renvoyé plus tard avec un autre compteur.
+//
+// Sans compteurs reçus d'un émetteur pour son époque, après le redémarrage du destinataire ou celui de l'émetteur,
+// rien ne distingue une enveloppe récente d'une enveloppe interceptée plus tôt dans la même époque. Le destinataire
+// refuse alors l'enveloppe et envoie à l'émetteur un défi contenant un nonce aléatoire, que l'émetteur reprend dans
+// toutes ses enveloppes suivantes. Seule une enveloppe portant le nonce du défi en cours ouvre une nouvelle époque. Les
+// défis sont eux-mêmes authentifiés, et un défi n'est accepté que s'il est plus récent que le dernier défi reçu.
+type replayGuard struct {
+	mutex      sync.Mutex
+	epoch      int64                 // Époque du processus
+	counters   map[int]uint64        // Dernier compteur utilisé pour chaque destinataire
+	windows    map[int]*replayWindow // Compteurs reçus de chaque émetteur
+	challenges map[int]*challenge    // Défi en cours pour chaque émetteur dont l'époque n'est pas encore acceptée
+	nonces     map[int]*challenge    // Dernier défi reçu de chaque destinataire, dont le nonce est repris dans les enveloppes
+}
+
+// challenge représente un défi envoyé à un émetteur ou reçu d'un destinataire.
+type challenge struct {
+	nonce   []byte    // Nonce du défi
+	sent    time.Time // Instant du dernier envoi du défi, pour un défi envoyé
+	epoch   int64     // Époque de l'enveloppe du défi, pour un défi reçu
+	counter uint64    // Compteur de l'enveloppe du défi, pour un défi reçu
+}
+
+// challengeRequired est l'erreur d'une enveloppe refusée faute de compteurs reçus pour l'époque de son émetteur.
+type challengeRequired struct {
+	kind   types.MessageKind // Sorte de l'enveloppe refusée
+	sender int               // Numéro de l'émetteur
+	nonce  []byte            // Nonce du défi à envoyer à l'émetteur, nil si un défi vient déjà de lui être envoyé
+}
+
+// Error retourne la raison du refus de l'enveloppe.
+func (e *challengeRequired) Error() string {
+	return fmt.Sprintf("%s message from P%d does not answer the challenge of its epoch", e.kind, e.sender)
+}
+
+// replayWindow représente les compteurs reçus d'un émetteur pour une époque donnée.
+type replayWindow struct {
+	epoch   int64  // Époque de l'émetteur
+	highest uint64 // Plus grand compteur reçu
+	seen    uint64 // Compteurs reçus parmi les précédents, le bit i correspondant au compteur highest - i
+}
+
+// newReplayGuard crée la protection contre le rejeu d'un processus avec une nouvelle époque.
+func newReplayGuard() *replayGuard {
+	return &replayGuard{
+		epoch:    time.Now().UnixNano(),
+		counters: make(map[int]uint64),
+		windows:  make(map[int]*replayWindow),
+
+		challenges: make(map[int]*challenge),
+		nonces:     make(map[int]*challenge),
+	}
+}
+
+// stamp ajoute à l'enveloppe l'époque du processus, le prochain compteur du destinataire spécifié et le nonce du
+// dernier défi reçu de celui-ci.
+func (g *replayGuard) stamp(to int, envelope *types.Envelope) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.counters[to]++
+	envelope.Epoch = g.epoch
+	envelope.Counter = g.counters[to]
+	if received, ok := g.nonces[to]; ok {
+		envelope.Nonce = received.nonce
+	}
+}
+
+// check enregistre le compteur d'une enveloppe reçue et retourne une erreur si l'enveloppe est rejouée. Une enveloppe
+// d'une époque dont aucune enveloppe n'a encore été acceptée est refusée avec une erreur challengeRequired, sauf si
+// elle porte le nonce du défi en cours.
+func (g *replayGuard) check(envelope *types.Envelope) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	window, ok := g.windows[envelope.Sender]
+	if ok && envelope.Epoch < window.epoch {
+		return fmt.Errorf("replayed %s message from a previous run of P%d", envelope.Kind, envelope.Sender)
+	}
+	if !ok || envelope.Epoch > window.epoch {
+		return g.open(envelope)
+	}
+
+	switch {
+	case envelope.Counter > window.highest:
+		shift := envelope.Counter - window.highest
+		if shift >= replayWindowSize {
+			window.seen = 0
+		} else {
+			window.seen <<= shift
+		}
+		window.seen |= 1
+		window.highest = envelope.Counter
+	case window.highest-envelope.Counter >= replayWindowSize:
+		return fmt.Errorf("%s message #%d from P%d is too old, latest is #%d", envelope.Kind, envelope.Counter, envelope.Sender, window.highest)
+	default:
+		bit := uint64(1) << (window.highest - envelope.Counter)
+		if window.seen&bit != 0 {
+			return fmt.Errorf("replayed %s message #%d from P%d", envelope.Kind, envelope.Counter, envelope.Sender)
+		}
+		window.seen |= bit
+	}
+	return nil
+}
+
+// open ouvre l'époque de l'émetteur de l'enveloppe si celle-ci porte le nonce du défi en cours. Sinon, l'enveloppe est
+// refusée et un nouveau défi est préparé, au plus un par intervalle afin de ne pas répondre à chaque enveloppe rejouée.
+// Le mutex doit être verrouillé par l'appelant.
+func (g *replayGuard) open(envelope *types.Envelope) error {
+	pending, ok := g.challenges[envelope.Sender]
+	if ok && hmac.Equal(envelope.Nonce, pending.nonce) {
+		delete(g.challenges, envelope.Sender)
+		g.windows[envelope.Sender] = &replayWindow{epoch: envelope.Epoch, highest: envelope.Counter, seen: 1}
+		return nil
+	}
+
+	refused := &challengeRequired{kind: envelope.Kind, sender: envelope.Sender}
+	now := time.Now()
+	if !ok {
+		nonce := make([]byte, nonceSize)
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		pending = &challenge{nonce: nonce}
+		g.challenges[envelope.Sender] = pending
+	} else if now.Sub(pending.sent) < challengeInterval {
+		return refused
+	}
+	pending.sent = now
+	refused.nonce = pending.nonce
+	return refused
+}
+
+// learn enregistre le défi contenu dans l'enveloppe d'un destinataire, afin de reprendre son nonce dans les enveloppes
+// suivantes. Le booléen vaut false si le défi est plus ancien que le dernier défi reçu du destinataire.
+func (g *replayGuard) learn(envelope *types.Envelope, nonce []byte) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if last, ok := g.nonces[envelope.Sender]; ok {
+		if envelope.Epoch < last.epoch || (envelope.Epoch == last.epoch && envelope.Counter <= last.counter) {
+			return false
+		}
+	}
+	g.nonces[envelope.Sender] = &challenge{nonce: nonce, epoch: envelope.Epoch, counter: envelope.Counter}
+	return true
+}
+
+// sendChallenge envoie un défi au processus spécifié, à son adresse dans la configuration.
+func (s *Server) sendChallenge(number int, nonce []byte) {
+	data, err := s.seal(number, types.ChallengeKind, "", types.ChallengeMessage{Number: s.Number, Nonce: nonce})
+	if err == nil {
+		err = s.send(s.Servers[number].Address, data)
+	}
+	if err != nil {
+		shared.Log(types.ERROR, err.Error())
+		return
+	}
+	shared.Log(types.DEBUG, "Sent a challenge to P"+strconv.Itoa(number))
+}
+
+// handleChallengeMessage traite un défi reçu d'un autre processus, dont le nonce est ensuite repris dans les enveloppes
+// qui lui sont envoyées.
+func (s *Server) handleChallengeMessage(envelope *types.Envelope) error {
+	message, err := decodePayload[types.ChallengeMessage](envelope)
+	if err != nil {
+		return err
+	}
+	if len(message.Nonce) != nonceSize {
+		return fmt.Errorf("invalid challenge from P%d", envelope.Sender)
+	}
+	if !s.replay.learn(envelope, message.Nonce) {
+		return fmt.Errorf("replayed challenge from P%d", envelope.Sender)
+	}
+	shared.Log(types.DEBUG, "Received a challenge from P"+strconv.Itoa(envelope.Sender))
+	return nil
+}
+
+// addressBook vérifie que les messages des autres serveurs proviennent de l'adresse de leur émetteur dans la
+// configuration. Les noms d'hôte de la configuration sont résolus à la première vérification puis mémorisés.
+type addressBook struct {
+	mutex    sync.Mutex
+	servers  map[int]types.Server // Serveurs de la configuration
+	hostOnly bool                 // Indique que seule l'adresse IP est vérifiée, le port d'une connexion TCP entrante étant choisi par le système
+	resolved map[string][]net.IP  // Adresses IP de chaque nom d'hôte déjà résolu
+}
+
+// newAddressBook crée le carnet d'adresses des serveurs spécifiés. Si hostOnly est vrai, le port d'origine des messages
+// n'est pas vérifié.
+func newAddressBook(servers map[int]types.Server, hostOnly bool) *addressBook {
+	return &addressBook{servers: servers, hostOnly: hostOnly, resolved: make(map[string][]net.IP)}
+}
+
+// check retourne une erreur si l'adresse spécifiée, d'où provient réellement le message, n'est pas celle du processus
+// qui prétend l'avoir envoyé.
+func (b *addressBook) check(from string, sender int) error {
+	server, ok := b.servers[sender]
+	if !ok {
+		return fmt.Errorf("message from unknown server P%d", sender)
+	}
+	if from == server.Address {
+		return nil
+	}
+
+	fromHost, fromPort, err := net.SplitHostPort(from)
+	if err != nil {
+		return fmt.Errorf("message claiming to come from P%d has an invalid source address", sender)
+	}
+	host, port, err := net.SplitHostPort(server.Address)
+	if err == nil && (b.hostOnly || port == fromPort) {
+		source := net.ParseIP(fromHost)
+		for _, ip := range b.resolve(host) {
+			if ip.Equal(source) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("spoofed sender, message claiming to come from P%d was not sent from %s", sender, server.Address)
+}
+
+// resolve retourne les adresses IP du nom d'hôte. Une résolution qui échoue n'est pas mémorisée et sera retentée.
+func (b *addressBook) resolve(host string) []net.IP {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if ips, ok := b.resolved[host]; ok {
+		return ips
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		b.resolved[host] = []net.IP{ip}
+		return b.resolved[host]
+	}
+	addresses, err := net.LookupHost(host)
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, address := range addresses {
+		if ip := net.ParseIP(address); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	b.resolved[host] = ips
+	return ips
+}
@@ -0,0 +1,132 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// exchange scelle une enveloppe du processus 1 vers le processus 0 avec la protection de l'émetteur et la vérifie avec
+// celle du destinataire.
+func exchange(sender *replayGuard, receiver *replayGuard) (*types.Envelope, error) {
+	envelope := &types.Envelope{Kind: types.HeartbeatKind, Sender: 1}
+	sender.stamp(0, envelope)
+	return envelope, receiver.check(envelope)
+}
+
+// answer transmet à l'émetteur le défi demandé par l'erreur de vérification du destinataire.
+func answer(t *testing.T, sender *replayGuard, receiver *replayGuard, err error) {
+	t.Helper()
+	var required *challengeRequired
+	if !errors.As(err, &required) || required.nonce == nil {
+		t.Fatalf("error %v, want a challenge", err)
+	}
+	envelope := &types.Envelope{Kind: types.ChallengeKind, Sender: 0}
+	receiver.stamp(1, envelope)
+	if !sender.learn(envelope, required.nonce) {
+		t.Fatal("challenge refused")
+	}
+}
+
+// TestReplayGuardChallenge vérifie qu'une époque n'est acceptée qu'après un défi, y compris après le redémarrage du
+// destinataire, et qu'une enveloppe déjà reçue est refusée.
+func TestReplayGuardChallenge(t *testing.T) {
+	sender, receiver := newReplayGuard(), newReplayGuard()
+
+	captured, err := exchange(sender, receiver)
+	answer(t, sender, receiver, err)
+	if _, err := exchange(sender, receiver); err != nil {
+		t.Fatalf("answered challenge refused: %v", err)
+	}
+	accepted, err := exchange(sender, receiver)
+	if err != nil {
+		t.Fatalf("next envelope refused: %v", err)
+	}
+	if err := receiver.check(accepted); err == nil {
+		t.Fatal("replayed envelope accepted")
+	}
+
+	// Le destinataire redémarre et ne connaît plus les compteurs de l'émetteur
+	restarted := newReplayGuard()
+	err = restarted.check(captured)
+	if err == nil {
+		t.Fatal("envelope captured before the restart accepted")
+	}
+	answer(t, sender, restarted, err)
+	if err := restarted.check(captured); err == nil {
+		t.Fatal("envelope captured before the challenge accepted")
+	}
+	if _, err := exchange(sender, restarted); err != nil {
+		t.Fatalf("answered challenge refused after the restart: %v", err)
+	}
+}
+
+// TestReplayGuardChallengeInterval vérifie qu'un même défi n'est pas renvoyé à chaque enveloppe refusée.
+func TestReplayGuardChallengeInterval(t *testing.T) {
+	sender, receiver := newReplayGuard(), newReplayGuard()
+
+	_, first := exchange(sender, receiver)
+	_, second := exchange(sender, receiver)
+	var required *challengeRequired
+	if !errors.As(first, &required) || required.nonce == nil {
+		t.Fatalf("error %v, want a challenge", first)
+	}
+	if !errors.As(second, &required) || required.nonce != nil {
+		t.Fatalf("error %v, want a refusal without a new challenge", second)
+	}
+}
+
+// TestReplayGuardLearn vérifie qu'un défi plus ancien que le dernier défi reçu est refusé.
+func TestReplayGuardLearn(t *testing.T) {
+	g := newReplayGuard()
+	older := &types.Envelope{Sender: 0, Epoch: 1, Counter: 1}
+	newer := &types.Envelope{Sender: 0, Epoch: 1, Counter: 2}
+
+	if !g.learn(newer, []byte("new")) {
+		t.Fatal("challenge refused")
+	}
+	if g.learn(older, []byte("old")) || g.learn(newer, []byte("old")) {
+		t.Fatal("replayed challenge accepted")
+	}
+
+	envelope := &types.Envelope{}
+	g.stamp(0, envelope)
+	if string(envelope.Nonce) != "new" {
+		t.Fatalf("nonce %q, want the one of the latest challenge", envelope.Nonce)
+	}
+}
+
+// TestAddressBookCheck vérifie l'origine des messages selon l'adresse configurée de leur émetteur.
+func TestAddressBookCheck(t *testing.T) {
+	servers := map[int]types.Server{0: {Address: "127.0.0.1:8080"}, 1: {Address: "server-1"}}
+
+	tests := []struct {
+		name     string
+		hostOnly bool
+		from     string
+		sender   int
+		valid    bool
+	}{
+		{"configured address", false, "127.0.0.1:8080", 0, true},
+		{"configured name", false, "server-1", 1, true},
+		{"other port", false, "127.0.0.1:9000", 0, false},
+		{"other host", false, "192.0.2.1:8080", 0, false},
+		{"address of another server", false, "server-1", 0, false},
+		{"unknown server", false, "127.0.0.1:8080", 7, false},
+		{"ephemeral TCP port", true, "127.0.0.1:53211", 0, true},
+		{"other TCP host", true, "192.0.2.1:53211", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newAddressBook(servers, test.hostOnly).check(test.from, test.sender)
+			if (err == nil) != test.valid {
+				t.Fatalf("valid %t, want %t (%v)", err == nil, test.valid, err)
+			}
+		})
+	}
+}
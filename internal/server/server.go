@@ -10,25 +10,28 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"net"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 
+	"github.com/Lazzzer/labo4-sdr/internal/codec"
 	"github.com/Lazzzer/labo4-sdr/internal/shared"
 	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/topology"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
 )
 
-// Channels
-var waveMessageChans = make(map[int](chan types.WaveMessage))           // Map de channels qui gère les messages issus de l'algorithme ondulatoire pour chaque processus voisin
-var probeEchoMessageChans = make(map[int](chan types.ProbeEchoMessage)) // Map de channels qui gère les messages issus de l'algorithme sondes et échos pour chaque processus voisin
-var textProcessedChan = make(chan bool, 1)                              // Channel qui indique si un texte a été traité ou non et bloque le traitement simultané
-var emitterChan = make(chan bool, 1)                                    // Channel qui gère si le serveur a déjà émis un message dans l'algorithme sondes et échos
+const (
+	defaultComputationTimeout = 30 * time.Second // Durée maximale d'un traitement si la configuration n'en spécifie pas
+)
 
 // Server est la structure qui représente un serveur UDP connecté dans un réseau de serveurs.
-// Elle contient les propriétés du processus et les propriétés du réseau.
+// Elle contient les propriétés du processus et les propriétés du réseau. Tout l'état d'exécution appartient à l'instance,
+// ce qui permet de lancer plusieurs serveurs dans un même programme. Un serveur doit être créé avec NewServer.
 type Server struct {
 	// Propriétés liées au réseau
 
@@ -37,82 +40,220 @@ type Server struct {
 
 	// Propriétés du processus
 
-	Number          int                  `json:"number"`           // Numéro du processus
-	NbProcesses     int                  `json:"nb_processes"`     // Nombre total de processus
-	Letter          string               `json:"letter"`           // Lettre gérée par le processus pour le comptage des occurrences
-	Parent          int                  `json:"parent"`           // Numéro du processus parent pour l'algorithme sondes et échos
-	Neighbors       map[int]types.Server `json:"neighbors"`        // Map prenant en clé le numéro du processus voisin et en valeur ses infos pour la communication sur le ré
-	ActiveNeighbors map[int]bool         `json:"active_neighbors"` // Map prenant en clé le numéro du processus voisin et en valeur un booléen pour l'algorithme ondulatoire
-	Counts          map[string]int       `json:"counts"`           // Map prenant en clé la lettre gérée par un processus et en valeur le nombre d'occurrences
-	Text            string               `json:"text"`             // Texte à traiter reçu par le serveur
+	Number     int            `json:"number"`     // Numéro du processus
+	Characters shared.CharSet `json:"characters"` // Ensemble des caractères gérés par le processus pour le comptage des occurrences
+	Join       *int           `json:"join"`       // Numéro du membre contacté pour rejoindre le réseau au lancement, nil si le serveur en fait déjà partie
+
+	ComputationTimeout time.Duration `json:"computation_timeout"` // Durée maximale d'un traitement, au-delà de laquelle son résultat est partiel
+
+	// Propriétés d'exécution
+
+	Network      transport.Network   `json:"-"` // Réseau utilisé pour créer le transport du serveur, peut être remplacé avant Run
+	reliable     *reliableLayer      // Couche de livraison fiable utilisée pour les messages entre serveurs
+	computations *computationStore   // Traitements connus du serveur
+	election     *electionState      // État de l'élection du leader du réseau
+	detector     *failureDetector    // Détecteur de pannes des voisins
+	dispatcher   *dispatcher         // Répartiteur des messages reçus des autres serveurs selon leur sorte
+	codecs       *codecNegotiation   // Codec utilisé pour les messages envoyés à chaque processus
+	keys         *keyring            // Clés authentifiant les messages échangés avec les autres serveurs
+	replay       *replayGuard        // Compteurs des messages échangés avec les autres serveurs, écartant les messages rejoués
+	admission    *admission          // Contrôle d'accès et limites des commandes des clients
+	membership   *membership         // Membres du réseau et voisins actuels du serveur
+	trees        *treeCache          // Arbres couvrants mémorisés de l'algorithme sondes et échos
+	transport    transport.Transport // Transport d'écoute du serveur, nil tant que le serveur n'est pas lancé
+	ctx          context.Context     // Contexte annulé lors de l'arrêt du serveur, parent des contextes des traitements
+	cancel       context.CancelFunc  // Fonction annulant le contexte du serveur
+	mutex        sync.Mutex          // Mutex protégeant le transport et l'arrêt du serveur
 }
 
-// Init est la fonction principale d'initialisation du serveur qui se lance au démarrage du programme.
-// Elle utilise une liste d'adjacence valide représentant un graphe logique des serveurs présents dans le réseau.
-// La méthode initialise les maps de voisin du processus ainsi que les channels de communication avec les voisins.
-func (s *Server) Init(adjacencyList *map[int][]int) {
-	textProcessedChan <- false
-	emitterChan <- false
+// NewServer crée le serveur du processus spécifié à partir de la configuration du réseau.
+// La configuration doit contenir une liste d'adjacence valide représentant un graphe logique des serveurs présents dans le réseau,
+// une configuration invalide est refusée avec la liste de ses problèmes. Si join n'est pas nil, le serveur ne fait pas
+// encore partie du réseau et demande à le rejoindre au membre spécifié lors de son lancement. La configuration doit alors
+// lister les membres initiaux du réseau sans le serveur, faute de quoi les serveurs en cours d'exécution le compteraient
+// comme membre avant son arrivée et attendraient ses comptages dans leurs traitements.
+func NewServer(number int, configuration *types.ServerConfig, join *int) (*Server, error) {
+	server, ok := configuration.Servers[number]
+	if !ok {
+		return nil, fmt.Errorf("invalid server number %d", number)
+	}
+	if join != nil {
+		if _, ok := configuration.Servers[*join]; !ok || *join == number {
+			return nil, fmt.Errorf("invalid server number %d to join", *join)
+		}
+		if len(configuration.Members) == 0 {
+			return nil, fmt.Errorf("members must list the initial members of the network for P%d to join it", number)
+		}
+		for _, member := range configuration.Members {
+			if member == number {
+				return nil, fmt.Errorf("P%d is an initial member in members and cannot join the network", number)
+			}
+		}
+	}
+
+	warnings, err := topology.Check(configuration)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		shared.Log(types.WARNING, warning.Message)
+	}
+
+	network, err := transport.New(configuration.Transport, transport.Options{
+		FragmentSize:   configuration.FragmentSize,
+		MaxMessageSize: configuration.MaxMessageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	preferred, err := codec.New(configuration.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := newKeyring(number, configuration)
+	if err != nil {
+		return nil, err
+	}
+	if keys.empty() {
+		shared.Log(types.WARNING, "No key configured, messages between servers are not authenticated")
+	}
+
+	admission, err := newAdmission(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultComputationTimeout
+	if configuration.ComputationTimeout != "" {
+		timeout, err = time.ParseDuration(configuration.ComputationTimeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid computation timeout %q", configuration.ComputationTimeout)
+		}
+	}
+
+	characters, err := shared.CharSetOf(server)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		Number:       number,
+		Characters:   characters,
+		Address:      server.Address,
+		Servers:      configuration.Servers,
+		Join:         join,
+		Network:      network,
+		reliable:     newReliableLayer(),
+		computations: &computationStore{byID: make(map[string]*computation)},
+		election:     newElectionState(),
+		trees:        newTreeCache(),
+		codecs:       newCodecNegotiation(preferred),
+		keys:         keys,
+		replay:       newReplayGuard(),
+		admission:    admission,
+		membership:   newMembership(number, configuration, join != nil),
+		ctx:          ctx,
+		cancel:       cancel,
 
-	// Initialisation de la map des voisins avec la liste d'adjacence
-	s.Neighbors = make(map[int]types.Server)
-	for i := 0; i < len((*adjacencyList)[s.Number]); i++ {
-		s.Neighbors[(*adjacencyList)[s.Number][i]] = s.Servers[(*adjacencyList)[s.Number][i]]
-		waveMessageChans[(*adjacencyList)[s.Number][i]] = make(chan types.WaveMessage, 1)
-		probeEchoMessageChans[(*adjacencyList)[s.Number][i]] = make(chan types.ProbeEchoMessage, 1)
+		ComputationTimeout: timeout,
 	}
+	s.detector = newFailureDetector(s.neighbors())
+	s.dispatcher = s.newDispatcher(configuration.Transport == transport.KindTCP)
+
+	return s, nil
 }
 
 // Run permet de démarrer l'écoute des connexions entrantes sur le port du serveur.
-// et lance la méthode principale qui boucle sur les connexions entrantes.
-func (s *Server) Run() {
-	udpAddr, err := net.ResolveUDPAddr("udp4", s.Address)
+// et lance la méthode principale qui boucle sur les connexions entrantes. La méthode ne retourne qu'en cas d'erreur
+// ou après l'arrêt du serveur avec Close.
+func (s *Server) Run() error {
+	t, err := s.Network.Listen(s.Address)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	connection, err := net.ListenUDP("udp4", udpAddr)
-	if err != nil {
-		log.Fatal(err)
+	s.mutex.Lock()
+	if s.ctx.Err() != nil {
+		s.mutex.Unlock()
+		return t.Close()
 	}
-	defer connection.Close()
+	s.transport = t
+	s.mutex.Unlock()
 
 	shared.Log(types.INFO, shared.GREEN+"Process P"+strconv.Itoa(s.Number)+" listening on "+s.Address+shared.RESET)
 
-	s.handleCommunications(connection)
+	if s.Join != nil {
+		go s.join(*s.Join)
+	}
+	go s.runDetector()
+	go s.runGossip()
+	go s.runElection()
+	s.handleCommunications(t)
+	return nil
 }
 
-// init permet l'initialisation des variables du serveur en fonction du type d'algorithme utilisé et (ré)initialise la
-// map de compteurs et la map des voisins actifs pour l'algorithme ondulatoire.
-func (s *Server) init(isWave bool) {
-	s.Counts = make(map[string]int)
+// Close arrête le serveur. Le transport est fermé, les retransmissions en attente sont abandonnées et les traitements
+// en cours sont annulés.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	if isWave {
-		s.ActiveNeighbors = make(map[int]bool)
-		for i := range s.Neighbors {
-			s.ActiveNeighbors[i] = true
-		}
+	if s.ctx.Err() != nil {
+		return nil
+	}
+	s.cancel()
+
+	if s.transport != nil {
+		return s.transport.Close()
 	}
+	return nil
+}
+
+// send envoie un message complet à l'adresse spécifiée avec le transport du serveur.
+func (s *Server) send(address string, data []byte) error {
+	s.mutex.Lock()
+	t := s.transport
+	s.mutex.Unlock()
+
+	if t == nil {
+		return fmt.Errorf("server is not running")
+	}
+	return t.Send(address, data)
 }
 
 // handleCommunications gère les communications du serveur.
-// La méthode écoute les messages entre serveurs pour les deux algorithmes  ainsi que les commandes des clients.
-func (s *Server) handleCommunications(connection *net.UDPConn) {
-	for {
-		buffer := make([]byte, 1024)
-		n, addr, err := connection.ReadFromUDP(buffer)
-		if err != nil {
-			shared.Log(types.ERROR, err.Error())
-			continue
-		}
-		communication := string(buffer[0:n])
+// La méthode écoute les messages entre serveurs pour les deux algorithmes  ainsi que les commandes des clients,
+// jusqu'à la fermeture du transport.
+func (s *Server) handleCommunications(t transport.Transport) {
+	for packet := range t.Receive() {
+		communication := string(packet.Data)
+		from := packet.From // Adresse de réponse, choisie par le pair avec le transport TCP
 
-		err = s.handleProbeEchoMessage(communication)
-		if err == nil {
+		// Les messages des autres serveurs sont des enveloppes, tout autre message est une commande d'un client
+		if envelope, err := open(packet.Data); err == nil {
+			if err := s.dispatcher.receive(packet.Remote, envelope); err != nil {
+				var required *challengeRequired
+				if errors.As(err, &required) {
+					shared.Log(types.DEBUG, "Message from "+packet.Remote+" rejected: "+err.Error())
+				} else {
+					shared.Log(types.ERROR, "Message from "+packet.Remote+" rejected: "+err.Error())
+				}
+			}
 			continue
 		}
-		err = s.handleWaveMessage(communication)
-		if err == nil {
+
+		// Une commande d'un client non autorisé ou dépassant sa limite est refusée avant d'être parsée, selon l'adresse
+		// d'où elle provient réellement
+		if reply, err := s.admission.admit(packet.Remote); err != nil {
+			shared.Log(types.WARNING, "Command from "+packet.Remote+" rejected: "+err.Error())
+			if reply {
+				if err := s.send(from, []byte(s.response(nil, "Command rejected: "+err.Error()))); err != nil {
+					shared.Log(types.ERROR, err.Error())
+				}
+			}
 			continue
 		}
 
@@ -124,11 +265,12 @@ func (s *Server) handleCommunications(connection *net.UDPConn) {
 			}
 			// Envoi de la réponse à l'adresse du client seulement si le serveur a généré un message de réponse
 			if response != "" {
-				_, err = connection.WriteToUDP([]byte(response), addr)
+				err = s.send(from, []byte(response))
 				if err != nil {
 					shared.Log(types.ERROR, err.Error())
+					return
 				}
-				shared.Log(types.INFO, "Response sent to "+addr.String())
+				shared.Log(types.INFO, "Response sent to "+from)
 			}
 		}()
 	}
@@ -136,6 +278,7 @@ func (s *Server) handleCommunications(connection *net.UDPConn) {
 
 // handleCommand gère les commandes reçues des clients UDP.
 // Si la commande est valide, on traite le type de commande et on retourne un message de réponse si nécessaire.
+// Chaque commande de traitement porte l'identifiant du traitement, ce qui permet à plusieurs traitements de se dérouler en même temps.
 func (s *Server) handleCommand(commandStr string) (string, error) {
 	command, err := shared.Parse[types.Command](commandStr)
 	if err != nil || command.Type == "" {
@@ -143,88 +286,175 @@ func (s *Server) handleCommand(commandStr string) (string, error) {
 	}
 
 	textToLog := ""
+	if command.ID != "" {
+		textToLog = " ID: " + command.ID
+	}
 	if command.Type != types.Ask {
-		textToLog = " Text: \"" + command.Text + "\""
+		textToLog += " Text: \"" + command.Text + "\""
 	}
 	shared.Log(types.COMMAND, "Type: "+string(command.Type)+textToLog)
 
 	if command.Type == types.Ask {
-		return s.handleAsk(command.Text), nil
+		return s.handleAsk(command.ID), nil
+	}
+	if command.Type == types.Leader {
+		return s.handleLeader(), nil
+	}
+	if command.Type == types.Status {
+		return s.handleStatus(), nil
+	}
+
+	if command.Type != types.WaveCount && command.Type != types.WaveStableCount && command.Type != types.ProbeCount {
+		return "", fmt.Errorf("unknown command type %s", command.Type)
 	}
 
-	<-textProcessedChan
+	if err := shared.ValidateTextOptions(command.Options); err != nil {
+		return "", err
+	}
+
+	if err := s.admission.acquire(s.ctx); err != nil {
+		shared.Log(types.WARNING, "Computation rejected: "+err.Error())
+		return s.response(nil, "Computation rejected: "+err.Error()), nil
+	}
+	defer s.admission.release()
+
+	if command.ID == "" {
+		command.ID = shared.NewComputationID()
+	}
+	c := s.getComputation(command.ID)
+	if !c.start() {
+		return "", fmt.Errorf("computation %s has already been started", command.ID)
+	}
+
+	ctx, cancel := s.computationContext()
+	defer cancel()
+
+	<-c.textProcessedChan
+	c.Options = command.Options
 	switch command.Type {
 	case types.WaveCount:
-		s.initWaveCount(command.Text)
+		s.initWaveCount(ctx, c, command.Text)
+	case types.WaveStableCount:
+		s.initStableWaveCount(ctx, c, command.Text)
 	case types.ProbeCount:
-		return s.initProbeEchoCountAsRoot(command.Text), nil
+		return s.initProbeEchoCountAsRoot(ctx, c, command.Text), nil
 	}
 	return "", nil
 }
 
-// handleAsk gère la commande "ask" des clients UDP. Si le serveur a déjà traité un texte, on retourne le nombre d'occurrences
-// de la lettre du serveur dans le texte. Sinon, on retourne un message d'erreur.
-func (s *Server) handleAsk(text string) string {
-	if !<-textProcessedChan {
-		textProcessedChan <- false
-		return "No processed text to show"
+// handleAsk gère la commande "ask" des clients UDP. Si le serveur a déjà traité le texte du traitement demandé, on retourne le nombre d'occurrences
+// des lettres dans le texte. Sinon, on retourne un message d'erreur. Sans identifiant, on utilise le dernier traitement auquel le serveur a participé.
+func (s *Server) handleAsk(id string) string {
+	c, ok := s.findComputation(id)
+	if !ok {
+		if id == "" {
+			return s.response(nil, "No processed text to show")
+		}
+		return s.response(nil, "No computation with ID "+id)
 	}
 
-	textProcessedChan <- true
-	return s.displayOccurrences(s.Counts)
-}
+	if !<-c.textProcessedChan {
+		c.textProcessedChan <- false
+		return s.response(nil, "No processed text to show")
+	}
 
-// countLetterOccurrences compte le nombre d'occurrences de la lettre du serveur dans le texte passé en paramètre.
-func (s *Server) countLetterOccurrences(text string) {
-	s.Counts[s.Letter] = strings.Count(strings.ToUpper(text), s.Letter)
-	shared.Log(types.INFO, "Letter "+s.Letter+" found "+strconv.Itoa(s.Counts[s.Letter])+" time(s) in \""+text+"\"")
+	result := s.result(c)
+	c.textProcessedChan <- true
+	return s.response(result, "")
 }
 
-// displayOccurrences retourne une chaîne de caractères contenant le nombre d'occurrences de chaque lettre du texte
-// traité par les serveurs du réseau. Seul les lettres capables d'être traitées par un serveur sont affichées.
-func (s *Server) displayOccurrences(counts map[string]int) string {
-	var result string
-	result += "---------------------\n"
-	result += "Servers in this network can process the following letters: "
-	for _, server := range s.Servers {
-		result += server.Letter + " "
-	}
-
-	result += "\nOccurrences of processable letters in \"" + s.Text + "\" :\n"
-	empty := true
-	for letter, count := range counts {
-		if count != 0 {
-			empty = false
-			result += shared.GREEN + letter + " : " + strconv.Itoa(count) + "\n" + shared.RESET
-		}
+// handleLeader gère la commande "leader" des clients. On retourne le leader élu connu du serveur, ou un message d'erreur
+// si aucune élection n'a encore abouti.
+func (s *Server) handleLeader() string {
+	leader, ok := s.currentLeader()
+	if !ok {
+		return s.response(nil, "No leader elected yet")
 	}
-	if empty {
-		result += shared.RED + "\nNo occurrence found\n\n" + shared.RESET
+	data, err := json.Marshal(types.Response{Server: s.Number, Leader: &leader})
+	if err != nil {
+		shared.Log(types.ERROR, err.Error())
+		return ""
 	}
-	result += "---------------------"
-	return result
+	return string(data)
 }
 
-// sendMessage est une fonction générique permettant d'envoyer un message de type T à un voisin du réseau en UDP.
-// Le message peut être de type WaveMessage ou ProbeEchoMessage.
-func sendMessage[T types.WaveMessage | types.ProbeEchoMessage](message T, neighbor types.Server) error {
-	messageJson, err := json.Marshal(message)
+// handleStatus gère la commande "status" des clients. On retourne l'état de chaque voisin selon le détecteur de pannes,
+// ainsi que le leader élu s'il est connu.
+func (s *Server) handleStatus() string {
+	response := types.Response{Server: s.Number, Neighbors: s.detector.statuses(s.neighbors())}
+	if leader, ok := s.currentLeader(); ok {
+		response.Leader = &leader
+	}
+	data, err := json.Marshal(response)
 	if err != nil {
 		shared.Log(types.ERROR, err.Error())
-		return err
+		return ""
 	}
+	return string(data)
+}
 
-	destUdpAddr, err := net.ResolveUDPAddr("udp", neighbor.Address)
+// countCharacterOccurrences compte le nombre d'occurrences de chaque caractère du serveur dans le texte du traitement,
+// après sa normalisation avec les options du traitement. Les caractères absents du texte n'apparaissent pas dans les compteurs.
+func (s *Server) countCharacterOccurrences(c *computation) {
+	text, err := shared.Normalize(c.Text, c.Options)
 	if err != nil {
-		return err
+		shared.Log(types.ERROR, "Cannot normalize text of computation "+c.ID+": "+err.Error())
+		return
 	}
-	connection, err := net.DialUDP("udp", nil, destUdpAddr)
-	if err != nil {
-		return err
+
+	counts := s.Characters.Count(text)
+	c.Counts[s.Number] = counts
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	shared.Log(types.INFO, "Characters "+s.Characters.String()+" found "+strconv.Itoa(total)+" time(s) in \""+c.Text+"\"")
+}
+
+// result retourne le résultat du traitement tel qu'il est connu par le serveur, avec les ensembles de caractères
+// traités par chaque serveur du réseau. Les comptages des processus sont agrégés à ce moment.
+func (s *Server) result(c *computation) *types.Result {
+	coverage := make(map[int]string)
+	for number, server := range s.Servers {
+		characters, _ := shared.CharSetOf(server)
+		coverage[number] = characters.String()
+	}
+
+	result := &types.Result{
+		ID:           c.ID,
+		Algorithm:    c.Algorithm,
+		Text:         c.Text,
+		Options:      c.Options,
+		Processes:    c.Counts,
+		Coverage:     coverage,
+		Partial:      c.Partial,
+		Unresponsive: c.Unresponsive,
+		CachedTree:   c.CachedTree,
+		StartedAt:    c.StartedAt,
+		FinishedAt:   c.FinishedAt,
+		DurationMs:   c.FinishedAt.Sub(c.StartedAt).Milliseconds(),
+	}
+	if c.Algorithm == types.ProbeCount {
+		root := c.Parent
+		result.Root = &root
+	}
+	if c.Partial {
+		result.Missing = c.missingProcesses(s.members())
+	}
+	result.Counts, result.Conflicts = s.aggregate(c.Counts)
+	return result
+}
+
+// response retourne la réponse JSON du serveur contenant le résultat spécifié, ou l'erreur si le résultat est nil.
+func (s *Server) response(result *types.Result, reason string) string {
+	response := types.Response{Server: s.Number, Result: result}
+	if result == nil {
+		response.Error = reason
 	}
-	_, err = connection.Write(messageJson)
+	data, err := json.Marshal(response)
 	if err != nil {
-		return err
+		shared.Log(types.ERROR, err.Error())
+		return ""
 	}
-	return nil
+	return string(data)
 }
@@ -0,0 +1,183 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"github.com/Lazzzer/labo4-sdr/internal/transport"
+)
+
+const responseTimeout = 10 * time.Second // Délai d'attente maximal d'une réponse d'un serveur dans les tests
+
+// testConfiguration retourne la configuration d'un réseau de trois serveurs en ligne, 0 - 1 - 2.
+func testConfiguration() *types.ServerConfig {
+	return &types.ServerConfig{
+		Servers: map[int]types.Server{
+			0: {Characters: []string{"A-H"}, Address: "server-0"},
+			1: {Characters: []string{"I-P"}, Address: "server-1"},
+			2: {Characters: []string{"Q-Z"}, Address: "server-2"},
+		},
+		AdjacencyList: map[int][]int{0: {1}, 1: {0, 2}, 2: {1}},
+	}
+}
+
+// newTestServer crée le serveur du processus spécifié dans la configuration de test, sans le lancer.
+func newTestServer(t *testing.T, number int) *Server {
+	t.Helper()
+	s, err := NewServer(number, testConfiguration(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// startServer lance le serveur du processus spécifié sur le réseau en mémoire et attend qu'il écoute. Si join n'est pas
+// nil, le serveur rejoint le réseau en contactant le membre spécifié.
+func startServer(t *testing.T, network *transport.MemoryNetwork, configuration *types.ServerConfig, number int, join *int) *Server {
+	t.Helper()
+	s, err := NewServer(number, configuration, join)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Network = network
+	go s.Run()
+	t.Cleanup(func() { s.Close() })
+
+	for deadline := time.Now().Add(responseTimeout); ; time.Sleep(10 * time.Millisecond) {
+		s.mutex.Lock()
+		listening := s.transport != nil
+		s.mutex.Unlock()
+		if listening {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("P%d is not listening", number)
+		}
+	}
+}
+
+// startNetwork lance tous les serveurs de la configuration sur un réseau en mémoire et retourne les serveurs lancés,
+// avec comme clé leur numéro de processus, ainsi que le transport d'un client de ce réseau.
+func startNetwork(t *testing.T, configuration *types.ServerConfig) (map[int]*Server, transport.Transport) {
+	t.Helper()
+	network := transport.NewMemoryNetwork()
+	servers := make(map[int]*Server)
+	for number := range configuration.Servers {
+		servers[number] = startServer(t, network, configuration, number, nil)
+	}
+	return servers, listenClient(t, network)
+}
+
+// listenClient retourne le transport d'un client du réseau en mémoire.
+func listenClient(t *testing.T, network *transport.MemoryNetwork) transport.Transport {
+	t.Helper()
+	client, err := network.Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// command envoie la commande au serveur à l'adresse spécifiée et retourne sa réponse, ou nil si wait est faux.
+func command(t *testing.T, client transport.Transport, address string, c types.Command, wait bool) *types.Response {
+	t.Helper()
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Send(address, data); err != nil {
+		t.Fatal(err)
+	}
+	if !wait {
+		return nil
+	}
+
+	select {
+	case packet := <-client.Receive():
+		var response types.Response
+		if err := json.Unmarshal(packet.Data, &response); err != nil {
+			t.Fatal(err)
+		}
+		return &response
+	case <-time.After(responseTimeout):
+		t.Fatalf("no response from %s to the %s command", address, c.Type)
+		return nil
+	}
+}
+
+// wave lance l'algorithme ondulatoire spécifié sur les serveurs spécifiés et retourne leurs réponses une fois le
+// traitement terminé sur chacun d'eux.
+func wave(t *testing.T, client transport.Transport, configuration *types.ServerConfig, c types.Command, numbers ...int) []*types.Response {
+	t.Helper()
+	for _, number := range numbers {
+		command(t, client, configuration.Servers[number].Address, c, false)
+	}
+	var responses []*types.Response
+	for _, number := range numbers {
+		deadline := time.Now().Add(responseTimeout)
+		for {
+			response := command(t, client, configuration.Servers[number].Address, types.Command{Type: types.Ask, ID: c.ID}, true)
+			if response.Result != nil || time.Now().After(deadline) {
+				responses = append(responses, response)
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return responses
+}
+
+// checkResult vérifie que la réponse contient un résultat complet avec les comptages attendus.
+func checkResult(t *testing.T, response *types.Response, counts map[string]int) {
+	t.Helper()
+	if response.Result == nil {
+		t.Fatalf("no result from P%d: %s", response.Server, response.Error)
+	}
+	if response.Result.Partial {
+		t.Fatalf("partial result from P%d, unresponsive processes %v", response.Server, response.Result.Unresponsive)
+	}
+	if !reflect.DeepEqual(response.Result.Counts, counts) {
+		t.Fatalf("counts %v from P%d, want %v", response.Result.Counts, response.Server, counts)
+	}
+}
+
+// TestNetworkCounts lance le réseau configuré en mémoire et vérifie les comptages de l'algorithme sondes et échos, avec
+// et sans arbre couvrant mémorisé, puis de l'algorithme ondulatoire lancé sur tous les serveurs.
+func TestNetworkCounts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("network test skipped in short mode")
+	}
+	configuration, err := shared.LoadConfig[types.ServerConfig]("../../cmd/server/config.json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, client := startNetwork(t, configuration)
+
+	text := "la pomme tombe, 2 fois!"
+	counts := map[string]int{"A": 1, "B": 1, "E": 2, "F": 1, "I": 1, "L": 1, "M": 3, "O": 3, "P": 1, "S": 1, "T": 1, "2": 1, ",": 1, "!": 1}
+
+	for i, root := range []int{4, 4, 0} {
+		response := command(t, client, configuration.Servers[root].Address, types.Command{Type: types.ProbeCount, Text: text}, true)
+		checkResult(t, response, counts)
+		if cached := i == 1; response.Result.CachedTree != cached {
+			t.Fatalf("probe %d from P%d used the cached tree: %t, want %t", i, root, response.Result.CachedTree, cached)
+		}
+	}
+
+	numbers := make([]int, 0, len(configuration.Servers))
+	for number := range configuration.Servers {
+		numbers = append(numbers, number)
+	}
+	for _, response := range wave(t, client, configuration, types.Command{Type: types.WaveCount, ID: "wave-test", Text: text}, numbers...) {
+		checkResult(t, response, counts)
+	}
+}
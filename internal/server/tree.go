@@ -0,0 +1,166 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package serveur propose un serveur UDP connecté dans un réseau de serveurs. Le serveur peut recevoir des commandes de clients UDP et
+// traiter des occurrences de lettre dans des textes de manière distribuée en utilisant l'algorithme ondulatoire ou l'algorithme sondes et échos.
+// Il est possible de choisir l'algorithme à utiliser en lui envoyant la commande correspondante avec le texte à traiter.
+// Le résultat est communiqué soit directement au client émetteur de la commande avec l'algorithme sondes et échos, soit sur demande
+// avec une commande "ask" lors de l'utilisation de l'algorithme ondulatoire. De plus, dans une analyse utilisant l'algorithme sondes et échos, le processus racine peut également recevoir
+// des commandes "ask" tant qu'il n'y a pas eu de nouveau traitement de texte.
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// spanningTree représente la position d'un processus dans l'arbre couvrant construit par l'algorithme sondes et échos
+// depuis une racine.
+type spanningTree struct {
+	Parent   int   // Parent du processus dans l'arbre, la racine est son propre parent
+	Children []int // Enfants du processus dans l'arbre, triés par ordre croissant
+}
+
+// treeCache mémorise la position du serveur dans le dernier arbre couvrant complet de chaque racine.
+//
+// Une fois l'arbre mémorisé, la racine diffuse les textes suivants uniquement le long de l'arbre et les comptages
+// remontent par le même chemin, ce qui demande 2(N-1) messages au lieu de deux messages par lien du graphe.
+// Un processus dont l'arbre mémorisé ne correspond pas au message reçu, ou dont un enfant est en panne, signale la
+// rupture à son parent. La racine oublie alors son arbre et revient à l'algorithme sondes et échos.
+type treeCache struct {
+	mutex  sync.Mutex
+	byRoot map[int]spanningTree // Position du serveur dans l'arbre de chaque racine, la clé est le numéro de la racine
+}
+
+// newTreeCache crée un cache d'arbres couvrants vide.
+func newTreeCache() *treeCache {
+	return &treeCache{byRoot: make(map[int]spanningTree)}
+}
+
+// get retourne la position du serveur dans l'arbre mémorisé de la racine. Le booléen vaut false si aucun arbre n'est mémorisé.
+func (t *treeCache) get(root int) (spanningTree, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tree, ok := t.byRoot[root]
+	return tree, ok
+}
+
+// set mémorise la position du serveur dans l'arbre de la racine.
+func (t *treeCache) set(root int, tree spanningTree) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.byRoot[root] = tree
+}
+
+// remove oublie l'arbre mémorisé de la racine.
+func (t *treeCache) remove(root int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.byRoot, root)
+}
+
+// treeAttempt diffuse le texte du traitement le long de l'arbre mémorisé de la racine et retourne false si l'arbre est
+// rompu ou ne couvre pas tous les processus du réseau.
+func (s *Server) treeAttempt(ctx context.Context, c *computation, tree spanningTree) bool {
+	shared.Log(types.PROBE, "Broadcasting text along the cached spanning tree")
+	c.Counts = make(types.ProcessCounts)
+	c.Known = map[int]bool{s.Number: true}
+	s.countCharacterOccurrences(c)
+
+	return s.convergecast(ctx, c, tree, s.Number) && len(c.missingProcesses(s.members())) == 0
+}
+
+// initTreeCountAsLeaf traite un texte diffusé le long de l'arbre mémorisé d'une racine en tant que processus feuille.
+// Le processus transmet le texte à ses enfants dans l'arbre, attend leurs comptages puis renvoie le sien à son parent,
+// en signalant une rupture si son arbre mémorisé ne correspond pas ou si un enfant ne répond pas.
+func (s *Server) initTreeCountAsLeaf(c *computation, message types.ProbeEchoMessage) {
+	<-c.textProcessedChan
+
+	c.init(false, s.neighbors())
+
+	ctx, cancel := s.budgetContext(message.Budget)
+	defer cancel()
+
+	shared.Log(types.PROBE, "Received broadcast from P"+strconv.Itoa(message.Number)+" for the spanning tree of P"+strconv.Itoa(message.Root))
+
+	c.Text = *message.Text
+	c.Options = message.Options
+	c.Parent = message.Number
+	c.CachedTree = true
+	c.Known = map[int]bool{s.Number: true}
+	s.countCharacterOccurrences(c)
+
+	tree, ok := s.trees.get(message.Root)
+	failed := !ok || tree.Parent != c.Parent || !s.convergecast(ctx, c, tree, message.Root)
+	if failed {
+		shared.Log(types.WARNING, "Spanning tree of P"+strconv.Itoa(message.Root)+" is broken here, reporting it to P"+strconv.Itoa(c.Parent))
+		s.trees.remove(message.Root)
+	}
+
+	newMessage := types.ProbeEchoMessage{
+		Type:   types.Convergecast,
+		ID:     c.ID,
+		Number: s.Number,
+		Counts: &c.Counts,
+		Known:  c.knownProcesses(),
+		Root:   message.Root,
+		Failed: failed,
+	}
+	sendMessage(s, newMessage, c.Parent)
+	shared.Log(types.ECHO, "Sent counts to P"+strconv.Itoa(c.Parent))
+
+	shared.Log(types.INFO, shared.CYAN+"Counts: "+fmt.Sprint(c.Counts)+shared.RESET)
+	c.FinishedAt = time.Now()
+	c.textProcessedChan <- false // Les serveurs feuilles ne peuvent pas répondre à des asks car leur map de comptage n'est pas complète
+}
+
+// convergecast transmet le texte du traitement aux enfants du serveur dans l'arbre et fusionne leurs comptages.
+// La méthode retourne false dès qu'un enfant est suspecté d'être en panne, ne répond pas avant l'expiration du contexte
+// ou signale une rupture de l'arbre.
+func (s *Server) convergecast(ctx context.Context, c *computation, tree spanningTree, root int) bool {
+	for _, child := range tree.Children {
+		if s.detector.isSuspected(child) {
+			shared.Log(types.WARNING, "Child P"+strconv.Itoa(child)+" is suspected to have crashed")
+			return false
+		}
+	}
+
+	message := types.ProbeEchoMessage{
+		Type:    types.Broadcast,
+		ID:      c.ID,
+		Number:  s.Number,
+		Text:    &c.Text,
+		Options: c.Options,
+		Budget:  budgetOf(ctx),
+		Root:    root,
+	}
+	for _, child := range tree.Children {
+		if err := sendMessage(s, message, child); err != nil {
+			shared.Log(types.ERROR, err.Error())
+		}
+		shared.Log(types.PROBE, "Sent broadcast to P"+strconv.Itoa(child))
+	}
+
+	for _, child := range tree.Children {
+		message, ok := receiveFrom(ctx, c.probeEchoMessages(child), s.detector.suspicion(child))
+		if !ok || message.Type != types.Convergecast || message.Failed || message.Counts == nil {
+			shared.Log(types.WARNING, "No counts from child P"+strconv.Itoa(child))
+			return false
+		}
+		shared.Log(types.ECHO, "Received counts from P"+strconv.Itoa(child))
+		c.mergeCounts(*message.Counts)
+		for _, number := range message.Known {
+			c.Known[number] = true
+		}
+	}
+	return true
+}
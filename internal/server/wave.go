@@ -10,68 +10,116 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/Lazzzer/labo4-sdr/internal/shared"
 	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
 )
 
-// initWaveCount initialise le comptage des occurrences de la lettre du serveur et applique l'algorithme ondulatoire
+// initWaveCount initialise le comptage des occurrences des caractères du serveur et applique l'algorithme ondulatoire
 // pour transmettre les informations aux voisins et recevoir leur comptage.
-func (s *Server) initWaveCount(text string) {
-	s.init(true)
-	s.Text = text
-	s.countLetterOccurrences(text)
+// Si le contexte expire avant la fin de l'algorithme, le traitement est interrompu et son résultat est marqué comme partiel
+// avec la liste des voisins n'ayant pas répondu.
+// Les voisins suspectés d'être en panne par le détecteur de pannes sont écartés et transmis aux autres processus avec
+// les processus connus. Le traitement se termine alors sans eux et son résultat est marqué comme partiel.
+func (s *Server) initWaveCount(ctx context.Context, c *computation, text string) {
+	neighbors := s.neighbors()
+	members := s.members()
+	c.init(true, neighbors)
+	c.Known[s.Number] = true
+	c.Text = text
+	s.countCharacterOccurrences(c)
+
+	peers := s.aliveNeighbors()
+	for i := range neighbors {
+		if !peers[i] {
+			c.Unreachable[i] = true
+			delete(c.ActiveNeighbors, i)
+		}
+	}
 
 	shared.Log(types.WAVE, shared.ORANGE+"Start building topology..."+shared.RESET)
 
 	// Boucle de création de la topologie
 
 	iteration := 1
-	for len(s.Counts) < s.NbProcesses {
+	for !c.covers(members) {
 		shared.Log(types.WAVE, shared.PINK+"Iteration "+strconv.Itoa(iteration)+shared.RESET)
 		iteration++
 
 		message := types.WaveMessage{
-			Type:   types.Wave,
-			Counts: s.Counts,
-			Number: s.Number,
-			Active: true,
+			Type:        types.Wave,
+			ID:          c.ID,
+			Counts:      c.Counts,
+			Known:       c.knownProcesses(),
+			Unreachable: c.unreachableProcesses(),
+			Number:      s.Number,
+			Active:      true,
 		}
-		for i, neighbor := range s.Neighbors {
-			err := sendMessage(message, neighbor)
+		for i := range peers {
+			err := sendMessage(s, message, i)
 			if err != nil {
 				shared.Log(types.ERROR, err.Error())
 			}
 			shared.Log(types.WAVE, "Sent message to P"+strconv.Itoa(i))
 		}
 
-		for i := range s.Neighbors {
-			message := <-waveMessageChans[i]
+		received := make(map[int]bool)
+		for i := range peers {
+			message, ok := receiveFrom(ctx, c.waveMessages(i), s.detector.suspicion(i))
+			if !ok {
+				if ctx.Err() == nil {
+					shared.Log(types.WARNING, "P"+strconv.Itoa(i)+" is suspected to have crashed, removed from the wave")
+					delete(peers, i)
+					delete(c.ActiveNeighbors, i)
+					c.Unreachable[i] = true
+				}
+				continue
+			}
+			received[i] = true
 			shared.Log(types.WAVE, "Received message from P"+strconv.Itoa(i))
-			for letter, count := range message.Counts {
-				s.Counts[letter] = count
+			c.mergeCounts(message.Counts)
+			for _, number := range message.Known {
+				c.Known[number] = true
+			}
+			for _, number := range message.Unreachable {
+				c.Unreachable[number] = true
 			}
 			if !message.Active {
-				delete(s.ActiveNeighbors, message.Number)
+				delete(c.ActiveNeighbors, message.Number)
 				shared.Log(types.WAVE, "P"+strconv.Itoa(i)+" is now inactive")
 			}
 		}
+
+		if len(received) < len(peers) {
+			for i := range peers {
+				if !received[i] {
+					c.Unresponsive = append(c.Unresponsive, i)
+				}
+			}
+			s.abortComputation(c)
+			return
+		}
 	}
 	shared.Log(types.WAVE, shared.ORANGE+"Topology built!"+shared.RESET)
 
 	// Envoi du message final aux voisins actifs
 
 	message := types.WaveMessage{
-		Type:   types.Wave,
-		Counts: s.Counts,
-		Number: s.Number,
-		Active: false,
+		Type:        types.Wave,
+		ID:          c.ID,
+		Counts:      c.Counts,
+		Known:       c.knownProcesses(),
+		Unreachable: c.unreachableProcesses(),
+		Number:      s.Number,
+		Active:      false,
 	}
 
-	for i := range s.ActiveNeighbors {
-		err := sendMessage(message, s.Neighbors[i])
+	for i := range c.ActiveNeighbors {
+		err := sendMessage(s, message, i)
 		if err != nil {
 			shared.Log(types.ERROR, err.Error())
 		}
@@ -80,28 +128,168 @@ func (s *Server) initWaveCount(text string) {
 
 	// Purge des derniers messages reçus
 
-	for i := range s.ActiveNeighbors {
-		<-waveMessageChans[i]
+	for i := range c.ActiveNeighbors {
+		if _, ok := receiveFrom(ctx, c.waveMessages(i), s.detector.suspicion(i)); !ok {
+			shared.Log(types.WAVE, "No last message from P"+strconv.Itoa(i)+", purge skipped")
+			continue
+		}
 		shared.Log(types.WAVE, "Purged message from P"+strconv.Itoa(i))
 	}
 
-	shared.Log(types.INFO, shared.CYAN+"Counts: "+fmt.Sprint(s.Counts)+shared.RESET)
+	if unreachable := c.unreachableProcesses(); len(unreachable) > 0 {
+		c.Partial = true
+		c.Unresponsive = unreachable
+		shared.Log(types.WARNING, "Processes suspected to have crashed were skipped: "+fmt.Sprint(unreachable))
+	}
+	shared.Log(types.INFO, shared.CYAN+"Counts: "+fmt.Sprint(c.Counts)+shared.RESET)
 	shared.Log(types.INFO, "Text \""+text+"\" has been processed")
-	textProcessedChan <- true
+	c.FinishedAt = time.Now()
+	c.textProcessedChan <- true
 }
 
-// handleWaveMessage gère les messages reçus des autres serveurs en UDP et s'assure que le message est destiné à l'algorithme ondulatoire
-// en vérifiant le type du message.
-func (s *Server) handleWaveMessage(messageStr string) error {
-	message, err := shared.Parse[types.WaveMessage](messageStr)
+// initStableWaveCount applique une variante de l'algorithme ondulatoire qui ne dépend ni du nombre de processus du
+// réseau ni de la répartition des caractères entre les serveurs.
+//
+// Les messages sont échangés par rondes : à chaque ronde, le serveur envoie ce qu'il connaît à ses voisins actifs puis
+// attend un message de chacun d'eux. Après la ronde r, le serveur connaît ainsi les comptages de tous les processus à
+// distance r au plus. Une ronde qui n'apporte aucun nouveau processus, connu ou écarté, signifie qu'aucun processus
+// n'existe à distance r, donc plus loin non plus : le serveur a atteint la stabilité, après un nombre de rondes égal à
+// son excentricité plus un, et termine en envoyant ce qu'il connaît à ses voisins encore actifs. Ses voisins obtiennent
+// alors tous les comptages et cessent d'attendre ses messages.
+func (s *Server) initStableWaveCount(ctx context.Context, c *computation, text string) {
+	neighbors := s.neighbors()
+	c.init(true, neighbors)
+	c.Algorithm = types.WaveStableCount
+	c.Known[s.Number] = true
+	c.Text = text
+	s.countCharacterOccurrences(c)
+
+	for i := range neighbors {
+		if s.detector.isSuspected(i) {
+			shared.Log(types.WARNING, "Skipping P"+strconv.Itoa(i)+", suspected to have crashed")
+			c.Unreachable[i] = true
+			delete(c.ActiveNeighbors, i)
+		}
+	}
+
+	shared.Log(types.WAVE, shared.ORANGE+"Start exchanging rounds until stability..."+shared.RESET)
+
+	for round := 1; len(c.ActiveNeighbors) > 0; round++ {
+		shared.Log(types.WAVE, shared.PINK+"Round "+strconv.Itoa(round)+shared.RESET)
+
+		message := types.WaveMessage{
+			Type:        types.Wave,
+			ID:          c.ID,
+			Counts:      c.Counts,
+			Known:       c.knownProcesses(),
+			Unreachable: c.unreachableProcesses(),
+			Number:      s.Number,
+			Active:      true,
+		}
+		for i := range c.ActiveNeighbors {
+			if err := sendMessage(s, message, i); err != nil {
+				shared.Log(types.ERROR, err.Error())
+			}
+			shared.Log(types.WAVE, "Sent message to P"+strconv.Itoa(i))
+		}
+
+		discovered := 0
+		for i := range c.ActiveNeighbors {
+			message, ok := receiveFrom(ctx, c.waveMessages(i), s.detector.suspicion(i))
+			if !ok {
+				if ctx.Err() != nil {
+					c.Unresponsive = append(c.Unresponsive, i)
+					continue
+				}
+				shared.Log(types.WARNING, "P"+strconv.Itoa(i)+" is suspected to have crashed, removed from the wave")
+				delete(c.ActiveNeighbors, i)
+				if !c.Known[i] && !c.Unreachable[i] {
+					discovered++
+				}
+				c.Unreachable[i] = true
+				continue
+			}
+			shared.Log(types.WAVE, "Received message from P"+strconv.Itoa(i))
+			c.mergeCounts(message.Counts)
+			for _, number := range message.Known {
+				if !c.Known[number] {
+					if !c.Unreachable[number] {
+						discovered++
+					}
+					c.Known[number] = true
+				}
+			}
+			for _, number := range message.Unreachable {
+				if !c.Known[number] && !c.Unreachable[number] {
+					discovered++
+				}
+				c.Unreachable[number] = true
+			}
+			if !message.Active {
+				delete(c.ActiveNeighbors, message.Number)
+				shared.Log(types.WAVE, "P"+strconv.Itoa(i)+" is now inactive")
+			}
+		}
+
+		if len(c.Unresponsive) > 0 {
+			s.abortComputation(c)
+			return
+		}
+		if discovered == 0 {
+			shared.Log(types.WAVE, "No new process in round "+strconv.Itoa(round))
+			break
+		}
+	}
+	shared.Log(types.WAVE, shared.ORANGE+"Stability reached!"+shared.RESET)
+
+	// Envoi du message final aux voisins actifs puis purge de leur dernier message
+
+	message := types.WaveMessage{
+		Type:        types.Wave,
+		ID:          c.ID,
+		Counts:      c.Counts,
+		Known:       c.knownProcesses(),
+		Unreachable: c.unreachableProcesses(),
+		Number:      s.Number,
+		Active:      false,
+	}
+	for i := range c.ActiveNeighbors {
+		if err := sendMessage(s, message, i); err != nil {
+			shared.Log(types.ERROR, err.Error())
+		}
+		shared.Log(types.WAVE, "Sent final message to active process P"+strconv.Itoa(i))
+	}
+	for i := range c.ActiveNeighbors {
+		if _, ok := receiveFrom(ctx, c.waveMessages(i), s.detector.suspicion(i)); !ok {
+			shared.Log(types.WAVE, "No last message from P"+strconv.Itoa(i)+", purge skipped")
+			continue
+		}
+		shared.Log(types.WAVE, "Purged message from P"+strconv.Itoa(i))
+	}
+
+	if unreachable := c.unreachableProcesses(); len(unreachable) > 0 {
+		c.Partial = true
+		c.Unresponsive = unreachable
+		shared.Log(types.WARNING, "Processes suspected to have crashed were skipped: "+fmt.Sprint(unreachable))
+	}
+	shared.Log(types.INFO, shared.CYAN+"Counts: "+fmt.Sprint(c.Counts)+shared.RESET)
+	shared.Log(types.INFO, "Text \""+text+"\" has been processed with the counts of "+strconv.Itoa(len(c.Known))+" process(es)")
+	c.FinishedAt = time.Now()
+	c.textProcessedChan <- true
+}
 
-	if err != nil || message.Type != types.Wave {
-		return fmt.Errorf("invalid message type")
+// handleWaveMessage gère les messages reçus des autres serveurs en UDP et s'assure que le message est destiné à l'algorithme ondulatoire
+// en vérifiant le type du message. Le message est transmis au traitement correspondant à son identifiant.
+func (s *Server) handleWaveMessage(envelope *types.Envelope) error {
+	message, err := decodePayload[types.WaveMessage](envelope)
+	if err != nil {
+		return err
+	}
+	if message.Type != types.Wave {
+		return fmt.Errorf("invalid wave message type %q from P%d", message.Type, envelope.Sender)
 	}
 
-	go func() {
-		waveMessageChans[message.Number] <- *message
-	}()
+	s.getComputation(message.ID).waveMessages(message.Number).put(*message)
 
 	return nil
 }
@@ -0,0 +1,55 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package server
+
+import (
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// TestStableWave vérifie sur un réseau en mémoire que la variante stable de l'algorithme ondulatoire termine sur
+// chaque serveur avec les mêmes comptages que l'algorithme ondulatoire.
+func TestStableWave(t *testing.T) {
+	if testing.Short() {
+		t.Skip("network test skipped in short mode")
+	}
+	configured, err := shared.LoadConfig[types.ServerConfig]("../../cmd/server/config.json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ligne 0-1-2 dont les extrémités comptent les mêmes caractères
+	replicated := testConfiguration()
+	replicated.Servers[2] = types.Server{Characters: []string{"A-H"}, Address: "server-2"}
+
+	text := "la pomme tombe, 2 fois!"
+	tests := []struct {
+		name          string
+		configuration *types.ServerConfig
+		counts        map[string]int
+	}{
+		{"line", testConfiguration(), map[string]int{"A": 1, "B": 1, "E": 2, "F": 1, "I": 1, "L": 1, "M": 3, "O": 3, "P": 1, "S": 1, "T": 1}},
+		{"replicated characters on a line", replicated, map[string]int{"A": 1, "B": 1, "E": 2, "F": 1, "I": 1, "L": 1, "M": 3, "O": 3, "P": 1}},
+		{"configured network", configured, map[string]int{"A": 1, "B": 1, "E": 2, "F": 1, "I": 1, "L": 1, "M": 3, "O": 3, "P": 1, "S": 1, "T": 1, "2": 1, ",": 1, "!": 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client := startNetwork(t, test.configuration)
+			var numbers []int
+			for number := range test.configuration.Servers {
+				numbers = append(numbers, number)
+			}
+			for _, algorithm := range []types.CommandType{types.WaveCount, types.WaveStableCount} {
+				for _, response := range wave(t, client, test.configuration, types.Command{Type: algorithm, ID: string(algorithm), Text: text}, numbers...) {
+					checkResult(t, response, test.counts)
+					if response.Result.Algorithm != algorithm {
+						t.Fatalf("result of the %s algorithm from P%d, want %s", response.Result.Algorithm, response.Server, algorithm)
+					}
+				}
+			}
+		})
+	}
+}
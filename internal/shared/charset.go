@@ -0,0 +1,130 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package shared
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// runeRange représente un intervalle de caractères, bornes comprises.
+type runeRange struct {
+	first rune
+	last  rune
+}
+
+// CharSet représente l'ensemble des caractères comptés par un serveur, sous forme d'intervalles triés et disjoints.
+type CharSet struct {
+	ranges []runeRange
+}
+
+// ParseCharSet crée un ensemble de caractères à partir de sa description. Chaque élément est soit un intervalle de
+// la forme "A-F", soit une suite de caractères isolés comme "AEIOU" ou "!?.". Un "-" seul désigne le tiret.
+func ParseCharSet(specs ...string) (CharSet, error) {
+	var ranges []runeRange
+	for _, spec := range specs {
+		if !utf8.ValidString(spec) {
+			return CharSet{}, fmt.Errorf("invalid character set %q: not valid UTF-8", spec)
+		}
+		runes := []rune(spec)
+		if len(runes) == 3 && runes[1] == '-' {
+			if runes[0] > runes[2] {
+				return CharSet{}, fmt.Errorf("invalid character range %q: %q comes after %q", spec, runes[0], runes[2])
+			}
+			ranges = append(ranges, runeRange{first: runes[0], last: runes[2]})
+			continue
+		}
+		for _, r := range runes {
+			ranges = append(ranges, runeRange{first: r, last: r})
+		}
+	}
+
+	// Tri et fusion des intervalles qui se chevauchent, les intervalles qui se touchent restent séparés pour que la
+	// description de l'ensemble reste proche de la configuration
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].first < ranges[j].first })
+	var merged []runeRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.first <= merged[n-1].last {
+			if r.last > merged[n-1].last {
+				merged[n-1].last = r.last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return CharSet{ranges: merged}, nil
+}
+
+// CharSetOf retourne l'ensemble des caractères comptés par le serveur, décrit par ses caractères et sa lettre.
+func CharSetOf(server types.Server) (CharSet, error) {
+	specs := server.Characters
+	if server.Letter != "" {
+		specs = append([]string{server.Letter}, specs...)
+	}
+	return ParseCharSet(specs...)
+}
+
+// Contains indique si le caractère fait partie de l'ensemble.
+func (set CharSet) Contains(r rune) bool {
+	i := sort.Search(len(set.ranges), func(i int) bool { return set.ranges[i].last >= r })
+	return i < len(set.ranges) && set.ranges[i].first <= r
+}
+
+// IsEmpty indique si l'ensemble ne contient aucun caractère.
+func (set CharSet) IsEmpty() bool {
+	return len(set.ranges) == 0
+}
+
+// Intersection retourne les caractères communs aux deux ensembles.
+func (set CharSet) Intersection(other CharSet) CharSet {
+	var ranges []runeRange
+	for i, j := 0, 0; i < len(set.ranges) && j < len(other.ranges); {
+		a, b := set.ranges[i], other.ranges[j]
+		first, last := a.first, a.last
+		if b.first > first {
+			first = b.first
+		}
+		if b.last < last {
+			last = b.last
+		}
+		if first <= last {
+			ranges = append(ranges, runeRange{first: first, last: last})
+		}
+		if a.last < b.last {
+			i++
+		} else {
+			j++
+		}
+	}
+	return CharSet{ranges: ranges}
+}
+
+// Count compte les occurrences de chaque caractère de l'ensemble dans le texte. Seuls les caractères présents dans
+// le texte apparaissent dans la map retournée.
+func (set CharSet) Count(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range text {
+		if set.Contains(r) {
+			counts[string(r)]++
+		}
+	}
+	return counts
+}
+
+// String retourne la description de l'ensemble, avec ses caractères isolés et ses intervalles séparés par des espaces.
+func (set CharSet) String() string {
+	parts := make([]string, len(set.ranges))
+	for i, r := range set.ranges {
+		if r.first == r.last {
+			parts[i] = string(r.first)
+		} else {
+			parts[i] = string(r.first) + "-" + string(r.last)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,141 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package shared
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// TestParseCharSet vérifie l'ensemble de caractères obtenu à partir de sa description.
+func TestParseCharSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		specs    []string
+		set      string // Description de l'ensemble obtenu
+		contains string // Caractères de l'ensemble
+		excludes string // Caractères hors de l'ensemble
+	}{
+		{"range", []string{"A-F"}, "A-F", "ACF", "@Ga"},
+		{"single characters", []string{"AEIOU"}, "A E I O U", "AEU", "BZ"},
+		{"punctuation", []string{".,;:!?'"}, "! ' , . : ; ?", "!?'", "-A"},
+		{"dash alone", []string{"-"}, "-", "-", "A"},
+		{"range of a single character", []string{"E-E"}, "E", "E", "DF"},
+		{"non-ASCII range", []string{"À-Ö"}, "À-Ö", "ÀÉÖ", "AØ"},
+		{"several ranges", []string{"0-9", "A-F"}, "0-9 A-F", "09AF", "G:"},
+		{"unsorted ranges", []string{"M-R", "A-F"}, "A-F M-R", "AM", "G"},
+		{"duplicate characters", []string{"AAB", "B"}, "A B", "AB", "C"},
+		{"duplicate ranges", []string{"A-F", "A-F"}, "A-F", "AF", "G"},
+		{"overlapping ranges", []string{"A-F", "D-K"}, "A-K", "AK", "L"},
+		{"range containing another", []string{"A-Z", "C-D"}, "A-Z", "AZ", "a"},
+		{"character inside a range", []string{"A-F", "C"}, "A-F", "C", "G"},
+		{"adjacent ranges kept separate", []string{"A-C", "D-F"}, "A-C D-F", "CD", "G"},
+		{"empty", nil, "", "", "A"},
+		{"empty description", []string{""}, "", "", "A"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := ParseCharSet(test.specs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if set.String() != test.set {
+				t.Fatalf("set %q, want %q", set.String(), test.set)
+			}
+			if set.IsEmpty() != (test.set == "") {
+				t.Fatalf("empty %t, want %t", set.IsEmpty(), test.set == "")
+			}
+			for _, r := range test.contains {
+				if !set.Contains(r) {
+					t.Fatalf("%q not in %q", r, set.String())
+				}
+			}
+			for _, r := range test.excludes {
+				if set.Contains(r) {
+					t.Fatalf("%q in %q", r, set.String())
+				}
+			}
+		})
+	}
+}
+
+// TestParseCharSetRejectsInvalid vérifie que les intervalles inversés et les descriptions invalides sont refusés.
+func TestParseCharSetRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"F-A", "9-0", "\xff"} {
+		if set, err := ParseCharSet(spec); err == nil {
+			t.Errorf("%q accepted as %q", spec, set.String())
+		}
+	}
+}
+
+// TestCharSetOf vérifie que la lettre d'un serveur s'ajoute à ses caractères.
+func TestCharSetOf(t *testing.T) {
+	set, err := CharSetOf(types.Server{Letter: "Z", Characters: []string{"A-C"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.String() != "A-C Z" {
+		t.Fatalf("set %q, want %q", set.String(), "A-C Z")
+	}
+}
+
+// TestCharSetIntersection vérifie les caractères communs à deux ensembles.
+func TestCharSetIntersection(t *testing.T) {
+	tests := []struct {
+		a, b         []string
+		intersection string
+	}{
+		{[]string{"A-F"}, []string{"D-K"}, "D-F"},
+		{[]string{"A-F"}, []string{"G-K"}, ""},
+		{[]string{"A-Z"}, []string{"C", "X-Y"}, "C X-Y"},
+		{[]string{"A-C", "X-Z"}, []string{"B-Y"}, "B-C X-Y"},
+		{[]string{"A-F"}, nil, ""},
+	}
+
+	for _, test := range tests {
+		a, err := ParseCharSet(test.a...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseCharSet(test.b...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if intersection := a.Intersection(b).String(); intersection != test.intersection {
+			t.Errorf("%v ∩ %v = %q, want %q", test.a, test.b, intersection, test.intersection)
+		}
+	}
+}
+
+// TestCharSetCount vérifie que seuls les caractères de l'ensemble présents dans le texte sont comptés.
+func TestCharSetCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		specs  []string
+		text   string
+		counts map[string]int
+	}{
+		{"range", []string{"A-F"}, "ABBA CAFE", map[string]int{"A": 3, "B": 2, "C": 1, "E": 1, "F": 1}},
+		{"duplicates counted once", []string{"A", "A-B"}, "AAB", map[string]int{"A": 2, "B": 1}},
+		{"non-ASCII characters", []string{"É"}, "ÉTÉ", map[string]int{"É": 2}},
+		{"no character of the set", []string{"X-Z"}, "ABC", map[string]int{}},
+		{"empty set", nil, "ABC", map[string]int{}},
+		{"empty text", []string{"A-Z"}, "", map[string]int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := ParseCharSet(test.specs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counts := set.Count(test.text); !reflect.DeepEqual(counts, test.counts) {
+				t.Fatalf("counts %v, want %v", counts, test.counts)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package shared
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// Variables d'environnement lues par les exécutables. Elles servent de valeur par défaut aux options de la ligne de commande.
+const (
+	EnvConfig = "SDR_CONFIG" // Chemin du fichier de configuration
+	EnvListen = "SDR_LISTEN" // Adresse d'écoute du serveur
+	EnvID     = "SDR_ID"     // Numéro du processus du serveur
+	EnvHTTP   = "SDR_HTTP"   // Adresse d'écoute HTTP de la passerelle
+	EnvJoin   = "SDR_JOIN"   // Numéro du membre contacté par le serveur pour rejoindre le réseau
+	EnvKey    = "SDR_KEY"    // Clé partagée authentifiant les messages entre serveurs, sans option pour ne pas apparaître dans la liste des processus
+)
+
+// LoadConfig charge la configuration depuis le fichier spécifié. Sans chemin, la configuration embarquée dans
+// l'exécutable est utilisée.
+func LoadConfig[T types.Config | types.ServerConfig](path string, embedded string) (*T, error) {
+	if path == "" {
+		return Parse[T](embedded)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configuration, err := Parse[T](string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return configuration, nil
+}
@@ -0,0 +1,197 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const (
+	DefaultFragmentSize   = 1024             // Taille par défaut en octets des données d'un fragment
+	DefaultMaxMessageSize = 1 << 20          // Taille maximale par défaut en octets d'un message réassemblé
+	MaxDatagramSize       = 65535            // Taille maximale d'un datagramme UDP, utilisée pour les buffers de lecture
+	maxUDPPayload         = 65507            // Taille maximale des données d'un datagramme UDP sur IPv4
+	maxPartialMessages    = 32               // Nombre maximal de messages en cours de réassemblage
+	reassemblyTimeout     = 10 * time.Second // Durée après laquelle un message incomplet est abandonné
+)
+
+// CheckFragmentSize vérifie que le plus grand fragment produit avec les tailles spécifiées, une fois sérialisé en JSON
+// avec ses données en base64, tient dans un datagramme UDP. Une taille nulle ou négative utilise la valeur par défaut.
+func CheckFragmentSize(fragmentSize int, maxMessageSize int) error {
+	if fragmentSize <= 0 {
+		fragmentSize = DefaultFragmentSize
+	}
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+	total := maxFragments(fragmentSize, maxMessageSize)
+	frame, err := json.Marshal(types.Fragment{
+		ID:    randomID(),
+		Index: total - 1,
+		Total: total,
+		Data:  make([]byte, fragmentSize),
+	})
+	if err != nil {
+		return err
+	}
+	if len(frame) > maxUDPPayload {
+		return fmt.Errorf("fragment size of %d bytes gives datagrams of %d bytes, over the UDP limit of %d bytes", fragmentSize, len(frame), maxUDPPayload)
+	}
+	return nil
+}
+
+// maxFragments retourne le nombre de fragments d'un message de la taille maximale spécifiée.
+func maxFragments(fragmentSize int, maxMessageSize int) int {
+	total := (maxMessageSize + fragmentSize - 1) / fragmentSize
+	if total == 0 {
+		total = 1
+	}
+	return total
+}
+
+// Split découpe un message en fragments numérotés sérialisés en JSON, chacun pouvant être envoyé dans un datagramme.
+// Une taille nulle ou négative utilise la valeur par défaut. Un message dépassant la taille maximale est refusé.
+func Split(message []byte, fragmentSize int, maxMessageSize int) ([][]byte, error) {
+	if fragmentSize <= 0 {
+		fragmentSize = DefaultFragmentSize
+	}
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+	if len(message) > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", len(message), maxMessageSize)
+	}
+
+	total := maxFragments(fragmentSize, len(message))
+
+	id := randomID()
+	frames := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * fragmentSize
+		if end > len(message) {
+			end = len(message)
+		}
+		frame, err := json.Marshal(types.Fragment{
+			ID:    id,
+			Index: i,
+			Total: total,
+			Data:  message[i*fragmentSize : end],
+		})
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// Reassembler reconstitue les messages à partir de leurs fragments, quel que soit leur ordre d'arrivée.
+// Les fragments en double sont ignorés et les messages restés incomplets trop longtemps sont abandonnés. Le nombre de
+// fragments d'un message et le nombre de messages en cours de réassemblage sont bornés, ce qui limite la mémoire
+// qu'un émetteur peut réserver.
+type Reassembler struct {
+	mutex          sync.Mutex
+	maxMessageSize int                        // Taille maximale en octets d'un message réassemblé
+	maxFragments   int                        // Nombre maximal de fragments d'un message
+	partials       map[string]*partialMessage // Messages en cours de réassemblage, la clé est l'identifiant du message
+}
+
+// partialMessage représente un message dont tous les fragments n'ont pas encore été reçus.
+type partialMessage struct {
+	fragments  [][]byte  // Données des fragments reçus, nil pour les fragments manquants
+	received   int       // Nombre de fragments reçus
+	size       int       // Taille cumulée des données reçues
+	lastUpdate time.Time // Date de réception du dernier fragment
+}
+
+// NewReassembler crée un Reassembler refusant les messages plus grands que la taille maximale spécifiée et les messages
+// découpés en plus de fragments qu'un message de cette taille avec la taille de fragment spécifiée. Une taille nulle ou
+// négative utilise la valeur par défaut.
+func NewReassembler(fragmentSize int, maxMessageSize int) *Reassembler {
+	if fragmentSize <= 0 {
+		fragmentSize = DefaultFragmentSize
+	}
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+	return &Reassembler{
+		maxMessageSize: maxMessageSize,
+		maxFragments:   maxFragments(fragmentSize, maxMessageSize),
+		partials:       make(map[string]*partialMessage),
+	}
+}
+
+// Add ajoute un datagramme reçu au message auquel il appartient. Le booléen vaut true et le message complet est
+// retourné lorsque le dernier fragment manquant est reçu.
+func (r *Reassembler) Add(datagram []byte) ([]byte, bool, error) {
+	fragment, err := Parse[types.Fragment](string(datagram))
+	if err != nil || fragment.ID == "" {
+		return nil, false, fmt.Errorf("invalid fragment")
+	}
+	if fragment.Total <= 0 || fragment.Index < 0 || fragment.Index >= fragment.Total || fragment.Total > r.maxFragments {
+		return nil, false, fmt.Errorf("invalid fragment %d/%d of message %s", fragment.Index, fragment.Total, fragment.ID)
+	}
+
+	if fragment.Total == 1 {
+		if len(fragment.Data) > r.maxMessageSize {
+			return nil, false, fmt.Errorf("message %s exceeds the limit of %d bytes", fragment.ID, r.maxMessageSize)
+		}
+		return fragment.Data, true, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.expire()
+
+	partial, ok := r.partials[fragment.ID]
+	if !ok {
+		if len(r.partials) >= maxPartialMessages {
+			return nil, false, fmt.Errorf("too many incomplete messages, fragment of message %s dropped", fragment.ID)
+		}
+		partial = &partialMessage{fragments: make([][]byte, fragment.Total)}
+		r.partials[fragment.ID] = partial
+	}
+	if len(partial.fragments) != fragment.Total {
+		return nil, false, fmt.Errorf("inconsistent fragment count for message %s", fragment.ID)
+	}
+	if partial.fragments[fragment.Index] != nil {
+		return nil, false, nil
+	}
+
+	partial.size += len(fragment.Data)
+	if partial.size > r.maxMessageSize {
+		delete(r.partials, fragment.ID)
+		return nil, false, fmt.Errorf("message %s exceeds the limit of %d bytes", fragment.ID, r.maxMessageSize)
+	}
+	partial.fragments[fragment.Index] = append([]byte{}, fragment.Data...)
+	partial.received++
+	partial.lastUpdate = time.Now()
+
+	if partial.received < fragment.Total {
+		return nil, false, nil
+	}
+
+	delete(r.partials, fragment.ID)
+	message := make([]byte, 0, partial.size)
+	for _, data := range partial.fragments {
+		message = append(message, data...)
+	}
+	return message, true, nil
+}
+
+// expire abandonne les messages incomplets dont aucun fragment n'a été reçu depuis trop longtemps.
+// Le mutex doit être verrouillé par l'appelant.
+func (r *Reassembler) expire() {
+	for id, partial := range r.partials {
+		if time.Since(partial.lastUpdate) > reassemblyTimeout {
+			delete(r.partials, id)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// fragment retourne le datagramme d'un fragment.
+func fragment(t *testing.T, id string, index int, total int, data string) []byte {
+	t.Helper()
+	datagram, err := json.Marshal(types.Fragment{ID: id, Index: index, Total: total, Data: []byte(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return datagram
+}
+
+// TestSplitReassemble vérifie qu'un message découpé est reconstitué quel que soit l'ordre d'arrivée de ses fragments.
+func TestSplitReassemble(t *testing.T) {
+	tests := []struct {
+		name         string
+		message      []byte
+		fragmentSize int
+		fragments    int
+		reverse      bool
+	}{
+		{"empty message", []byte{}, 4, 1, false},
+		{"single fragment", []byte("abc"), 4, 1, false},
+		{"exact multiple", []byte("abcdefgh"), 4, 2, false},
+		{"several fragments", []byte("abcdefghij"), 4, 3, false},
+		{"reverse order", []byte("abcdefghij"), 4, 3, true},
+		{"default fragment size", bytes.Repeat([]byte("x"), 3*DefaultFragmentSize), 0, 3, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frames, err := Split(test.message, test.fragmentSize, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != test.fragments {
+				t.Fatalf("%d fragments, want %d", len(frames), test.fragments)
+			}
+			if test.reverse {
+				for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+					frames[i], frames[j] = frames[j], frames[i]
+				}
+			}
+
+			r := NewReassembler(test.fragmentSize, 0)
+			for i, frame := range frames {
+				message, complete, err := r.Add(frame)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if complete != (i == len(frames)-1) {
+					t.Fatalf("message complete after %d of %d fragments: %t", i+1, len(frames), complete)
+				}
+				if complete && !bytes.Equal(message, test.message) {
+					t.Fatalf("message %q, want %q", message, test.message)
+				}
+			}
+		})
+	}
+}
+
+// TestSplitTooLarge vérifie qu'un message dépassant la taille maximale n'est pas découpé.
+func TestSplitTooLarge(t *testing.T) {
+	if _, err := Split(make([]byte, 11), 4, 10); err == nil {
+		t.Fatal("message over the limit split")
+	}
+}
+
+// TestCheckFragmentSize vérifie que les tailles de fragments produisant des datagrammes trop grands sont refusées.
+func TestCheckFragmentSize(t *testing.T) {
+	tests := []struct {
+		fragmentSize int
+		valid        bool
+	}{
+		{0, true},
+		{DefaultFragmentSize, true},
+		{48000, true},
+		{49200, false},
+		{MaxDatagramSize, false},
+	}
+
+	for _, test := range tests {
+		if err := CheckFragmentSize(test.fragmentSize, 0); (err == nil) != test.valid {
+			t.Errorf("fragment size %d: valid %t, want %t (%v)", test.fragmentSize, err == nil, test.valid, err)
+		}
+	}
+}
+
+// TestReassemblerPartialLimit vérifie que le nombre de messages en cours de réassemblage est borné.
+func TestReassemblerPartialLimit(t *testing.T) {
+	r := NewReassembler(0, 0)
+	for i := 0; i < maxPartialMessages; i++ {
+		if _, _, err := r.Add(fragment(t, fmt.Sprint(i), 0, 2, "a")); err != nil {
+			t.Fatalf("fragment of message %d refused: %v", i, err)
+		}
+	}
+	if _, _, err := r.Add(fragment(t, "new", 0, 2, "a")); err == nil {
+		t.Fatal("fragment of a new message accepted over the limit")
+	}
+	if _, complete, err := r.Add(fragment(t, "0", 1, 2, "b")); err != nil || !complete {
+		t.Fatalf("last fragment of a pending message: complete %t, error %v", complete, err)
+	}
+	if _, _, err := r.Add(fragment(t, "new", 0, 2, "a")); err != nil {
+		t.Fatalf("fragment of a new message refused once a message is complete: %v", err)
+	}
+}
+
+// TestReassemblerAdd vérifie le traitement des fragments invalides, en double ou dépassant la taille maximale.
+func TestReassemblerAdd(t *testing.T) {
+	tests := []struct {
+		name      string
+		datagrams func(t *testing.T) [][]byte
+		message   string // Message complet attendu après le dernier datagramme, vide si aucun
+		err       bool   // Indique si le dernier datagramme doit être refusé
+	}{
+		{
+			name:      "not a fragment",
+			datagrams: func(t *testing.T) [][]byte { return [][]byte{[]byte(`{"command_type":"ask"}`)} },
+			err:       true,
+		},
+		{
+			name:      "missing ID",
+			datagrams: func(t *testing.T) [][]byte { return [][]byte{fragment(t, "", 0, 1, "a")} },
+			err:       true,
+		},
+		{
+			name:      "index out of range",
+			datagrams: func(t *testing.T) [][]byte { return [][]byte{fragment(t, "m", 2, 2, "a")} },
+			err:       true,
+		},
+		{
+			name:      "negative index",
+			datagrams: func(t *testing.T) [][]byte { return [][]byte{fragment(t, "m", -1, 2, "a")} },
+			err:       true,
+		},
+		{
+			name:      "more fragments than the largest message",
+			datagrams: func(t *testing.T) [][]byte { return [][]byte{fragment(t, "m", 0, 4, "a")} },
+			err:       true,
+		},
+		{
+			name:      "no fragment",
+			datagrams: func(t *testing.T) [][]byte { return [][]byte{fragment(t, "m", 0, 0, "a")} },
+			err:       true,
+		},
+		{
+			name: "duplicate fragment",
+			datagrams: func(t *testing.T) [][]byte {
+				return [][]byte{fragment(t, "m", 0, 2, "ab"), fragment(t, "m", 0, 2, "xx"), fragment(t, "m", 1, 2, "cd")}
+			},
+			message: "abcd",
+		},
+		{
+			name: "inconsistent fragment count",
+			datagrams: func(t *testing.T) [][]byte {
+				return [][]byte{fragment(t, "m", 0, 2, "ab"), fragment(t, "m", 1, 3, "cd")}
+			},
+			err: true,
+		},
+		{
+			name:      "single fragment over the limit",
+			datagrams: func(t *testing.T) [][]byte { return [][]byte{fragment(t, "m", 0, 1, "abcdefghijk")} },
+			err:       true,
+		},
+		{
+			name: "fragments over the limit",
+			datagrams: func(t *testing.T) [][]byte {
+				return [][]byte{fragment(t, "m", 0, 3, "abcd"), fragment(t, "m", 1, 3, "efgh"), fragment(t, "m", 2, 3, "ijk")}
+			},
+			err: true,
+		},
+		{
+			name: "interleaved messages",
+			datagrams: func(t *testing.T) [][]byte {
+				return [][]byte{fragment(t, "a", 0, 2, "ab"), fragment(t, "b", 0, 2, "xy"), fragment(t, "b", 1, 2, "z")}
+			},
+			message: "xyz",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewReassembler(4, 10)
+			datagrams := test.datagrams(t)
+			var message []byte
+			var complete bool
+			var err error
+			for i, datagram := range datagrams {
+				message, complete, err = r.Add(datagram)
+				if err != nil && i < len(datagrams)-1 {
+					t.Fatalf("datagram %d refused: %v", i, err)
+				}
+			}
+			if (err != nil) != test.err {
+				t.Fatalf("error %v, want error %t", err, test.err)
+			}
+			if complete != (test.message != "") || string(message) != test.message {
+				t.Fatalf("message %q complete %t, want %q", message, complete, test.message)
+			}
+		})
+	}
+}
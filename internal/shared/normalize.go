@@ -0,0 +1,77 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package shared
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ligatures associe chaque ligature à sa forme développée.
+var ligatures = strings.NewReplacer(
+	"œ", "oe", "Œ", "OE",
+	"æ", "ae", "Æ", "AE",
+	"ß", "ss", "ẞ", "SS",
+	"ĳ", "ij", "Ĳ", "IJ",
+	"ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st",
+)
+
+// normalizationForms associe le nom de chaque forme de normalisation Unicode à sa forme.
+var normalizationForms = map[string]norm.Form{
+	types.NFC:  norm.NFC,
+	types.NFD:  norm.NFD,
+	types.NFKC: norm.NFKC,
+	types.NFKD: norm.NFKD,
+}
+
+// ValidateTextOptions vérifie que les options de normalisation sont valides.
+func ValidateTextOptions(options types.TextOptions) error {
+	if _, ok := normalizationForms[formOf(options)]; !ok {
+		return fmt.Errorf("unknown normalization form %q", options.Form)
+	}
+	return nil
+}
+
+// Normalize applique au texte les options de normalisation avant le comptage des caractères. Les étapes sont toujours
+// appliquées dans le même ordre, ce qui garantit le même résultat sur chaque serveur :
+//   - suppression des diacritiques, sauf avec KeepDiacritics ("é" devient "e")
+//   - développement des ligatures, sauf avec KeepLigatures ("œ" devient "oe")
+//   - passage en majuscules, sauf avec CaseSensitive
+//   - normalisation Unicode dans la forme demandée, NFC par défaut
+func Normalize(text string, options types.TextOptions) (string, error) {
+	form, ok := normalizationForms[formOf(options)]
+	if !ok {
+		return "", fmt.Errorf("unknown normalization form %q", options.Form)
+	}
+
+	if !options.KeepDiacritics {
+		removeMarks := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+		folded, _, err := transform.String(removeMarks, text)
+		if err != nil {
+			return "", err
+		}
+		text = folded
+	}
+	if !options.KeepLigatures {
+		text = ligatures.Replace(text)
+	}
+	if !options.CaseSensitive {
+		text = strings.ToUpper(text)
+	}
+	return form.String(text), nil
+}
+
+// formOf retourne le nom de la forme de normalisation des options, NFC par défaut.
+func formOf(options types.TextOptions) string {
+	if options.Form == "" {
+		return types.NFC
+	}
+	return strings.ToUpper(options.Form)
+}
@@ -0,0 +1,68 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package shared
+
+import (
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// TestNormalize vérifie le texte normalisé selon chaque option, en particulier qu'un caractère accentué donne le même
+// résultat qu'il soit composé (NFC) ou décomposé (NFD).
+func TestNormalize(t *testing.T) {
+	const (
+		composed   = "\u00e9"  // "é" composé
+		decomposed = "e\u0301" // "e" suivi de l'accent aigu combinant
+	)
+
+	tests := []struct {
+		name       string
+		text       string
+		options    types.TextOptions
+		normalized string
+	}{
+		{"composed accent folded", composed, types.TextOptions{}, "E"},
+		{"decomposed accent folded", decomposed, types.TextOptions{}, "E"},
+		{"uppercase accent folded", "È", types.TextOptions{}, "E"},
+		{"composed accent kept", composed, types.TextOptions{KeepDiacritics: true}, "\u00c9"},
+		{"decomposed accent kept", decomposed, types.TextOptions{KeepDiacritics: true}, "\u00c9"},
+		{"accent kept in NFD", composed, types.TextOptions{KeepDiacritics: true, Form: types.NFD}, "E\u0301"},
+		{"lowercase form name", composed, types.TextOptions{KeepDiacritics: true, Form: "nfd"}, "E\u0301"},
+		{"case sensitive", "Été", types.TextOptions{CaseSensitive: true}, "Ete"},
+		{"case sensitive with accents", decomposed + "T" + composed, types.TextOptions{CaseSensitive: true, KeepDiacritics: true}, "\u00e9T\u00e9"},
+		{"ligature expanded", "cœur", types.TextOptions{}, "COEUR"},
+		{"ligature kept", "cœur", types.TextOptions{KeepLigatures: true}, "CŒUR"},
+		{"ligature expanded case sensitive", "Œuvre", types.TextOptions{CaseSensitive: true}, "OEuvre"},
+		{"compatibility character kept in NFC", "x²", types.TextOptions{}, "X²"},
+		{"compatibility character replaced in NFKC", "x²", types.TextOptions{Form: types.NFKC}, "X2"},
+		{"compatibility character replaced in NFKD", "x²", types.TextOptions{Form: types.NFKD}, "X2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalized, err := Normalize(test.text, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if normalized != test.normalized {
+				t.Fatalf("normalized %q, want %q", normalized, test.normalized)
+			}
+		})
+	}
+}
+
+// TestNormalizeRejectsUnknownForm vérifie qu'une forme de normalisation inconnue est refusée.
+func TestNormalizeRejectsUnknownForm(t *testing.T) {
+	options := types.TextOptions{Form: "NFX"}
+	if err := ValidateTextOptions(options); err == nil {
+		t.Fatal("unknown form accepted")
+	}
+	if _, err := Normalize("a", options); err == nil {
+		t.Fatal("text normalized with an unknown form")
+	}
+	if err := ValidateTextOptions(types.TextOptions{}); err != nil {
+		t.Fatalf("default form rejected: %v", err)
+	}
+}
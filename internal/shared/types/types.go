@@ -4,19 +4,41 @@
 // Package types propose différents types utilisés par l'application pour parser le fichier de configuration, les messages et les commandes.
 package types
 
+import "time"
+
 // Config représente la configuration du réseau de serveurs.
 type Config struct {
-	Servers map[int]string `json:"servers"` // Liste des adresse des serveurs disponibles
+	Servers        map[int]string `json:"servers"`                    // Liste des adresse des serveurs disponibles
+	Transport      string         `json:"transport,omitempty"`        // Type de transport utilisé ("udp" par défaut ou "tcp")
+	FragmentSize   int            `json:"fragment_size,omitempty"`    // Taille maximale en octets des données d'un fragment
+	MaxMessageSize int            `json:"max_message_size,omitempty"` // Taille maximale en octets d'un message une fois réassemblé
 }
 
 type ServerConfig struct {
-	Servers       map[int]Server `json:"servers"`        // Liste des serveurs disponibles avec leur lettre et leur adresse
-	AdjacencyList map[int][]int  `json:"adjacency_list"` // Liste d'adjacence des serveurs
+	Servers        map[int]Server `json:"servers"`                    // Liste des serveurs disponibles avec leur lettre et leur adresse
+	AdjacencyList  map[int][]int  `json:"adjacency_list"`             // Liste d'adjacence des serveurs
+	Transport      string         `json:"transport,omitempty"`        // Type de transport utilisé ("udp" par défaut ou "tcp")
+	FragmentSize   int            `json:"fragment_size,omitempty"`    // Taille maximale en octets des données d'un fragment
+	MaxMessageSize int            `json:"max_message_size,omitempty"` // Taille maximale en octets d'un message une fois réassemblé
+
+	ComputationTimeout string `json:"computation_timeout,omitempty"` // Durée maximale d'un traitement, par exemple "30s"
+	Members            []int  `json:"members,omitempty"`             // Serveurs membres du réseau au démarrage, tous les serveurs si vide, obligatoire si des serveurs rejoignent le réseau
+	Codec              string `json:"codec,omitempty"`               // Codec préféré des messages entre serveurs ("json" par défaut ou "binary")
+
+	Key      string            `json:"key,omitempty"`       // Clé partagée par tous les serveurs pour authentifier leurs messages, aucune authentification si vide
+	LinkKeys map[string]string `json:"link_keys,omitempty"` // Clés propres à certains liens, indexées par les numéros des deux serveurs (par exemple "0-1"), prioritaires sur la clé partagée
+
+	AllowedClients            []string `json:"allowed_clients,omitempty"`             // Plages CIDR ou adresses des clients autorisés à envoyer des commandes, tous les clients si vide
+	RateLimit                 float64  `json:"rate_limit,omitempty"`                  // Nombre de commandes par seconde autorisées pour chaque adresse de client, 10 par défaut
+	RateBurst                 int      `json:"rate_burst,omitempty"`                  // Nombre de commandes qu'un client peut envoyer d'un coup, 20 par défaut
+	MaxConcurrentComputations int      `json:"max_concurrent_computations,omitempty"` // Nombre maximal de traitements demandés par des clients en cours sur le serveur, 8 par défaut, les suivants sont mis en attente
+	MaxQueuedComputations     int      `json:"max_queued_computations,omitempty"`     // Nombre maximal de traitements demandés par des clients en attente d'une place, 16 par défaut, les suivants sont refusés
 }
 
 type Server struct {
-	Letter  string `json:"letter"`  // Lettre à compter
-	Address string `json:"address"` // Adresse du serveur
+	Letter     string   `json:"letter,omitempty"`     // Lettre à compter, équivalente à un ensemble d'un seul caractère
+	Characters []string `json:"characters,omitempty"` // Caractères à compter, chaque élément est un intervalle comme "A-F" ou une suite de caractères
+	Address    string   `json:"address"`              // Adresse du serveur
 }
 
 type LogType string // Type de log
@@ -25,6 +47,7 @@ const (
 	INFO    LogType = "INFO"    // Log d'information
 	DEBUG   LogType = "DEBUG"   // Log de debug
 	ERROR   LogType = "ERROR"   // Log d'erreur
+	WARNING LogType = "WARNING" // Log d'avertissement
 	COMMAND LogType = "COMMAND" // Log de commande
 	WAVE    LogType = "WAVE"    // Log de message wave
 	PROBE   LogType = "PROBE"   // Log de message probe
@@ -34,38 +57,229 @@ const (
 type CommandType string // Type de commande
 
 const (
-	WaveCount  CommandType = "wave"  // Commande de comptage des occurrences de lettres avec un algorithme ondulatoire
-	ProbeCount CommandType = "probe" // Commande de comptage des occurrences de lettres avec un algorithme de sondes et échos
-	Ask        CommandType = "ask"   // Commande de demande du résultat d'un comptage sur un texte
-	Quit       CommandType = "quit"  // Commande de fermeture du client
+	WaveCount       CommandType = "wave"        // Commande de comptage des occurrences de lettres avec un algorithme ondulatoire
+	WaveStableCount CommandType = "wave-stable" // Commande de comptage avec l'algorithme ondulatoire terminant à la stabilité, sans connaître le nombre de processus
+	ProbeCount      CommandType = "probe"       // Commande de comptage des occurrences de lettres avec un algorithme de sondes et échos
+	Ask             CommandType = "ask"         // Commande de demande du résultat d'un comptage sur un texte
+	Quit            CommandType = "quit"        // Commande de fermeture du client
+	Leader          CommandType = "leader"      // Commande de demande du leader élu du réseau
+	Status          CommandType = "status"      // Commande de demande de l'état des voisins d'un serveur
 )
 
 // Command représente une commande envoyée par un client.
 type Command struct {
-	Type CommandType `json:"command_type"`   // Type de la commande
-	Text string      `json:"text,omitempty"` // Texte à analyser
+	Type    CommandType `json:"command_type"`   // Type de la commande
+	ID      string      `json:"id,omitempty"`   // Identifiant du traitement créé ou demandé par la commande
+	Text    string      `json:"text,omitempty"` // Texte à analyser
+	Options TextOptions `json:"options"`        // Options de normalisation du texte avant le comptage
+}
+
+// Response représente la réponse d'un serveur à une commande, qui contient soit le résultat d'un traitement, soit une erreur.
+type Response struct {
+	Server    int              `json:"server"`              // Numéro du processus qui répond
+	Leader    *int             `json:"leader,omitempty"`    // Leader élu connu du processus, pour les commandes leader et status
+	Neighbors []NeighborStatus `json:"neighbors,omitempty"` // État des voisins du processus, pour la commande status
+	Result    *Result          `json:"result,omitempty"`    // Résultat du traitement demandé
+	Error     string           `json:"error,omitempty"`     // Raison pour laquelle aucun résultat n'est disponible
+}
+
+type NeighborState string // État d'un voisin selon le détecteur de pannes
+
+const (
+	Alive     NeighborState = "alive"     // Le voisin a donné signe de vie récemment
+	Suspected NeighborState = "suspected" // Le voisin n'a pas donné signe de vie depuis trop longtemps et est considéré en panne
+)
+
+// NeighborStatus représente l'état d'un voisin d'un processus selon son détecteur de pannes.
+type NeighborStatus struct {
+	Number     int           `json:"number"`       // Numéro du processus voisin
+	Address    string        `json:"address"`      // Adresse du processus voisin
+	State      NeighborState `json:"state"`        // État du voisin
+	LastSeenMs int64         `json:"last_seen_ms"` // Temps écoulé depuis le dernier message reçu du voisin, en millisecondes
+}
+
+// Result représente le résultat d'un traitement de texte, tel qu'il est connu par le serveur qui le communique.
+type Result struct {
+	ID           string         `json:"id"`                     // Identifiant du traitement
+	Algorithm    CommandType    `json:"algorithm"`              // Algorithme utilisé (wave ou probe)
+	Root         *int           `json:"root,omitempty"`         // Numéro du processus racine pour l'algorithme sondes et échos
+	Text         string         `json:"text"`                   // Texte traité, avant sa normalisation
+	Options      TextOptions    `json:"options"`                // Options de normalisation appliquées au texte
+	Counts       map[string]int `json:"counts"`                 // Nombre d'occurrences de chaque caractère présent dans le texte
+	Processes    ProcessCounts  `json:"processes"`              // Comptages de chaque processus, à partir desquels Counts est calculé
+	Conflicts    []Conflict     `json:"conflicts,omitempty"`    // Caractères dont le nombre d'occurrences diffère entre les processus qui les comptent
+	Coverage     map[int]string `json:"coverage"`               // Ensemble des caractères traités par chaque processus du réseau
+	Partial      bool           `json:"partial,omitempty"`      // Indique si le traitement a été interrompu par son échéance
+	Unresponsive []int          `json:"unresponsive,omitempty"` // Numéros des processus n'ayant pas répondu avant l'échéance ou en panne
+	Missing      []int          `json:"missing,omitempty"`      // Numéros des processus dont les comptages manquent au résultat partiel
+	CachedTree   bool           `json:"cached_tree,omitempty"`  // Indique si le texte a été diffusé le long de l'arbre couvrant mémorisé par la racine
+	StartedAt    time.Time      `json:"started_at"`             // Début du traitement sur le serveur
+	FinishedAt   time.Time      `json:"finished_at"`            // Fin du traitement sur le serveur
+	DurationMs   int64          `json:"duration_ms"`            // Durée du traitement sur le serveur en millisecondes
+}
+
+// ProcessCounts représente les comptages de plusieurs processus. La clé est le numéro du processus et la valeur le
+// nombre d'occurrences de chacun de ses caractères présents dans le texte.
+type ProcessCounts map[int]map[string]int
+
+// Conflict représente un caractère compté par plusieurs processus qui ne sont pas d'accord sur son nombre d'occurrences.
+type Conflict struct {
+	Character string      `json:"character"` // Caractère concerné
+	Counts    map[int]int `json:"counts"`    // Nombre d'occurrences selon chaque processus comptant le caractère
+	Retained  int         `json:"retained"`  // Nombre d'occurrences retenu dans le résultat, celui de la majorité des processus
+}
+
+// Formes de normalisation Unicode disponibles pour les options de normalisation d'un texte.
+const (
+	NFC  = "NFC"  // Décomposition canonique puis composition canonique, forme par défaut
+	NFD  = "NFD"  // Décomposition canonique
+	NFKC = "NFKC" // Décomposition de compatibilité puis composition canonique
+	NFKD = "NFKD" // Décomposition de compatibilité
+)
+
+// TextOptions représente les options de normalisation appliquées à un texte avant le comptage des caractères.
+// Les valeurs par défaut comptent sans tenir compte de la casse, des diacritiques et des ligatures.
+type TextOptions struct {
+	CaseSensitive  bool   `json:"case_sensitive,omitempty"`  // Distingue les majuscules des minuscules
+	KeepDiacritics bool   `json:"keep_diacritics,omitempty"` // Conserve les diacritiques, "é" n'est alors pas compté comme "e"
+	KeepLigatures  bool   `json:"keep_ligatures,omitempty"`  // Conserve les ligatures, "œ" n'est alors pas compté comme "oe"
+	Form           string `json:"form,omitempty"`            // Forme de normalisation Unicode (NFC, NFD, NFKC ou NFKD), NFC par défaut
 }
 
 type MessageType string // Type de message probe ou echo
 
 // WaveMessage représente un message de l'algorithme ondulatoire envoyé par un processus.
 type WaveMessage struct {
-	Type   MessageType    `json:"type"`   // Type de message
-	Counts map[string]int `json:"counts"` //  Map qui contient le compteur de chaque lettre gérée par les processus
-	Number int            `json:"number"` // Numéro du processus qui envoie le message
-	Active bool           `json:"active"` // Indique si le voisin est actif ou non
+	Type        MessageType   `json:"type"`                  // Type de message
+	ID          string        `json:"id"`                    // Identifiant du traitement auquel appartient le message
+	Counts      ProcessCounts `json:"counts"`                // Comptages des processus connus de l'émetteur
+	Known       []int         `json:"known"`                 // Numéros des processus dont les comptages sont inclus dans le message
+	Unreachable []int         `json:"unreachable,omitempty"` // Numéros des processus en panne selon les processus qui les ont écartés
+	Number      int           `json:"number"`                // Numéro du processus qui envoie le message
+	Active      bool          `json:"active"`                // Indique si le voisin est actif ou non
 }
 
 const (
 	Wave  MessageType = "wave"  // Message de type wave
 	Probe MessageType = "probe" // Message de type probe
 	Echo  MessageType = "echo"  // Message de type echo
+	Data  MessageType = "data"  // Message de données de la couche de livraison fiable
+	Ack   MessageType = "ack"   // Message d'acquittement de la couche de livraison fiable
+
+	Datagram    MessageType = "datagram"     // Message de la couche de livraison fiable envoyé sans numéro de séquence ni acquittement
+	Election    MessageType = "election"     // Message de la vague d'élection d'un initiateur
+	Coordinator MessageType = "coordinator"  // Annonce du leader élu à la fin d'une élection
+	LeaderAlive MessageType = "leader_alive" // Annonce périodique du leader indiquant qu'il est toujours actif
+	Heartbeat   MessageType = "heartbeat"    // Signe de vie périodique d'un processus envoyé à ses voisins
+
+	Broadcast    MessageType = "broadcast"    // Diffusion d'un texte le long de l'arbre couvrant mémorisé d'une racine
+	Convergecast MessageType = "convergecast" // Remontée des comptages le long de l'arbre couvrant mémorisé d'une racine
+
+	Join    MessageType = "join"    // Demande d'un serveur pour rejoindre le réseau, envoyée à un membre
+	Welcome MessageType = "welcome" // Réponse d'un membre à une demande pour rejoindre le réseau, contenant les membres connus
+	Gossip  MessageType = "gossip"  // Diffusion périodique des membres connus aux voisins
 )
 
 // ProbeEchoMessage représente un message de l'algorithme de sondes et échos envoyé par un processus.
 type ProbeEchoMessage struct {
-	Type   MessageType     `json:"type"`   // Type de message (sonde ou écho)
-	Number int             `json:"number"` // Numéro du processus qui envoie le message
-	Text   *string         `json:"text"`   // Texte à analyser
-	Counts *map[string]int `json:"counts"` //  Map qui contient le compteur de chaque lettre gérée par les processus
+	Type         MessageType    `json:"type"`                   // Type de message (sonde ou écho)
+	ID           string         `json:"id"`                     // Identifiant du traitement auquel appartient le message
+	Number       int            `json:"number"`                 // Numéro du processus qui envoie le message
+	Text         *string        `json:"text"`                   // Texte à analyser
+	Options      TextOptions    `json:"options"`                // Options de normalisation du texte, identiques sur tous les processus
+	Counts       *ProcessCounts `json:"counts"`                 // Comptages des processus du sous-arbre de l'émetteur d'un écho
+	Budget       time.Duration  `json:"budget,omitempty"`       // Temps restant au traitement de l'émetteur d'une sonde lors de son envoi, indépendant de son horloge
+	Unresponsive []int          `json:"unresponsive,omitempty"` // Numéros des processus injoignables dans le sous-arbre de l'émetteur d'un écho partiel
+	Known        []int          `json:"known,omitempty"`        // Numéros des processus dont les comptages sont inclus dans un écho
+	Root         int            `json:"root"`                   // Numéro du processus racine du traitement
+	Failed       bool           `json:"failed,omitempty"`       // Indique qu'un lien de l'arbre couvrant mémorisé est rompu, pour une remontée
+	Exclude      []int          `json:"exclude,omitempty"`      // Numéros des processus écartés par la racine, qui ne doivent être ni sondés ni attendus
+}
+
+// ReliableMessage représente un message de la couche de livraison fiable entre serveurs.
+// Un message de données encapsule un WaveMessage ou un ProbeEchoMessage et doit être acquitté par le destinataire.
+type ReliableMessage struct {
+	Type    MessageType `json:"type"`              // Type de message (données, acquittement ou datagramme)
+	Number  int         `json:"number"`            // Numéro du processus qui envoie le message
+	Epoch   int64       `json:"epoch"`             // Époque de l'émetteur des données, change à chaque redémarrage du processus
+	Seq     uint64      `json:"seq"`               // Numéro de séquence du message sur le lien entre les deux processus
+	Base    uint64      `json:"base"`              // Plus petit numéro de séquence encore en attente d'acquittement, les précédents ne seront plus retransmis
+	Payload []byte      `json:"payload,omitempty"` // Enveloppe encapsulée, encodée avec le codec de l'émetteur
+}
+
+// ElectionMessage représente un message de l'élection du leader du réseau.
+type ElectionMessage struct {
+	Type      MessageType `json:"type"`                // Type de message (élection, coordinateur ou annonce de vie du leader)
+	Number    int         `json:"number"`              // Numéro du processus qui envoie le message
+	Term      int         `json:"term"`                // Numéro de l'élection, une élection plus récente remplace les précédentes
+	Initiator int         `json:"initiator,omitempty"` // Initiateur de la vague d'élection à laquelle appartient le message
+	Leader    int         `json:"leader,omitempty"`    // Leader élu, pour les annonces du coordinateur et de vie du leader
+	Seq       uint64      `json:"seq,omitempty"`       // Numéro de l'annonce de vie du leader
+}
+
+// HeartbeatMessage représente le signe de vie périodique qu'un processus envoie à ses voisins pour le détecteur de pannes.
+type HeartbeatMessage struct {
+	Type   MessageType `json:"type"`             // Type de message
+	Number int         `json:"number"`           // Numéro du processus qui envoie le message
+	Codecs []string    `json:"codecs,omitempty"` // Codecs que l'émetteur sait décoder, pour la négociation du codec du lien
+}
+
+// Member représente l'état d'un serveur dans la liste des membres du réseau.
+type Member struct {
+	Number      int    `json:"number"`         // Numéro du processus
+	Incarnation uint64 `json:"incarnation"`    // Incarnation du processus, un état plus récent remplace les précédents
+	Left        bool   `json:"left,omitempty"` // Indique que le processus a quitté le réseau
+}
+
+// MembershipMessage représente un message du protocole d'appartenance au réseau. Ces messages sont échangés hors de la
+// couche de livraison fiable, car l'émetteur n'est pas forcément encore un voisin du destinataire.
+type MembershipMessage struct {
+	Type    MessageType `json:"type"`    // Type de message (demande, bienvenue ou diffusion)
+	Number  int         `json:"number"`  // Numéro du processus qui envoie le message
+	Members []Member    `json:"members"` // Membres connus de l'émetteur
+}
+
+// ChallengeMessage représente un défi envoyé à un processus dont aucune enveloppe de l'époque actuelle n'a encore été
+// acceptée. Le processus doit reprendre le nonce du défi dans ses enveloppes suivantes pour prouver qu'elles sont récentes.
+type ChallengeMessage struct {
+	Number int    `json:"number"` // Numéro du processus qui envoie le défi
+	Nonce  []byte `json:"nonce"`  // Valeur aléatoire à reprendre dans les enveloppes suivantes
+}
+
+// ProtocolVersion est la version du protocole entre serveurs. Un message d'une autre version est refusé.
+const ProtocolVersion = 6
+
+type MessageKind string // Sorte de message entre serveurs, qui détermine le traitement de son contenu
+
+const (
+	MembershipKind MessageKind = "membership" // Message du protocole d'appartenance au réseau
+	ReliableKind   MessageKind = "reliable"   // Message de la couche de livraison fiable, qui transporte une autre enveloppe
+	HeartbeatKind  MessageKind = "heartbeat"  // Signe de vie du détecteur de pannes
+	ProbeEchoKind  MessageKind = "probe-echo" // Message de l'algorithme sondes et échos
+	WaveKind       MessageKind = "wave"       // Message de l'algorithme ondulatoire
+	ElectionKind   MessageKind = "election"   // Message de l'élection du leader
+	ChallengeKind  MessageKind = "challenge"  // Défi prouvant la fraîcheur des enveloppes d'une nouvelle époque
+)
+
+// Envelope représente l'enveloppe de tout message échangé entre serveurs. La sorte du message détermine le type de son
+// contenu, ce qui évite de deviner le type d'un message en essayant de le parser avec chacun des types possibles.
+type Envelope struct {
+	Kind        MessageKind `json:"kind"`                  // Sorte du message
+	Version     int         `json:"version"`               // Version du protocole de l'émetteur
+	Sender      int         `json:"sender"`                // Numéro du processus qui envoie le message
+	Computation string      `json:"computation,omitempty"` // Identifiant du traitement auquel appartient le message, le cas échéant
+	Epoch       int64       `json:"epoch"`                 // Époque de l'émetteur, change à chaque démarrage du processus
+	Counter     uint64      `json:"counter"`               // Compteur croissant des messages de l'émetteur vers le destinataire, écarte les messages rejoués
+	Nonce       []byte      `json:"nonce,omitempty"`       // Nonce du dernier défi reçu du destinataire, absent si le destinataire n'a pas envoyé de défi
+	Payload     []byte      `json:"payload"`               // Contenu du message encodé avec le codec de l'enveloppe, son type dépend de la sorte du message
+	MAC         []byte      `json:"mac,omitempty"`         // Code d'authentification HMAC-SHA256 de l'enveloppe, absent si le lien n'a pas de clé
+}
+
+// Fragment représente une partie numérotée d'un message trop grand pour être envoyé dans un seul datagramme.
+// Tous les messages échangés, commandes et réponses comprises, sont envoyés sous forme de fragments.
+type Fragment struct {
+	ID    string `json:"fragment_id"` // Identifiant du message auquel appartient le fragment
+	Index int    `json:"index"`       // Position du fragment dans le message, à partir de 0
+	Total int    `json:"total"`       // Nombre total de fragments du message
+	Data  []byte `json:"data"`        // Données du fragment
 }
@@ -6,6 +6,8 @@
 package shared
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 
@@ -13,7 +15,7 @@ import (
 )
 
 // Parse permet de parser un objet JSON en un objet de type T.
-func Parse[T types.Config | types.ServerConfig | types.Command | types.WaveMessage | types.ProbeEchoMessage](jsonStr string) (*T, error) {
+func Parse[T types.Config | types.ServerConfig | types.Command | types.Fragment | types.Response](jsonStr string) (*T, error) {
 	var object T
 
 	err := json.Unmarshal([]byte(jsonStr), &object)
@@ -24,6 +26,20 @@ func Parse[T types.Config | types.ServerConfig | types.Command | types.WaveMessa
 	return &object, nil
 }
 
+// NewComputationID génère un identifiant aléatoire pour un nouveau traitement de texte.
+func NewComputationID() string {
+	return randomID()
+}
+
+// randomID génère un identifiant aléatoire de 16 caractères hexadécimaux.
+func randomID() string {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(bytes)
+}
+
 // Log permet d'afficher un message dans la console avec une couleur différente selon le type de log.
 func Log(logType types.LogType, message string) {
 	switch logType {
@@ -33,6 +49,8 @@ func Log(logType types.LogType, message string) {
 		log.Println(ORANGE + "(DEBUG) " + RESET + message)
 	case types.ERROR:
 		log.Println(RED + "(ERROR) " + RESET + message)
+	case types.WARNING:
+		log.Println(ORANGE + "(WARNING) " + RESET + message)
 	case types.COMMAND:
 		log.Println(YELLOW + "(COMMAND) " + RESET + message)
 	case types.WAVE:
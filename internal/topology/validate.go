@@ -0,0 +1,231 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package topology propose la validation de la configuration d'un réseau de serveurs.
+// Une configuration invalide, par exemple un arc à sens unique ou un serveur inconnu, bloque les algorithmes de comptage
+// et doit donc être refusée avant le démarrage d'un serveur.
+package topology
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// Severity représente la gravité d'un problème détecté dans une configuration.
+type Severity string
+
+const (
+	Error   Severity = "error"   // Problème empêchant le fonctionnement du réseau, la configuration est refusée
+	Warning Severity = "warning" // Problème n'empêchant pas le fonctionnement du réseau
+)
+
+// Issue représente un problème détecté dans une configuration.
+type Issue struct {
+	Severity Severity // Gravité du problème
+	Message  string   // Description précise du problème
+}
+
+// String retourne la gravité et la description du problème.
+func (i Issue) String() string {
+	return string(i.Severity) + ": " + i.Message
+}
+
+// ValidationError est l'erreur retournée par Check lorsque la configuration contient au moins un problème de gravité Error.
+type ValidationError struct {
+	Issues []Issue // Problèmes de gravité Error
+}
+
+// Error retourne la liste des problèmes, un par ligne.
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		messages[i] = issue.Message
+	}
+	return "invalid topology:\n  - " + strings.Join(messages, "\n  - ")
+}
+
+// Check valide la configuration et retourne les avertissements. Si la configuration contient des erreurs, elles sont
+// retournées dans une ValidationError.
+func Check(configuration *types.ServerConfig) ([]Issue, error) {
+	var warnings, errors []Issue
+	for _, issue := range Validate(configuration) {
+		if issue.Severity == Error {
+			errors = append(errors, issue)
+		} else {
+			warnings = append(warnings, issue)
+		}
+	}
+	if len(errors) > 0 {
+		return warnings, &ValidationError{Issues: errors}
+	}
+	return warnings, nil
+}
+
+// Validate retourne tous les problèmes détectés dans la configuration, dans un ordre déterministe.
+// Les vérifications portent sur les serveurs (adresse manquante ou dupliquée, ensemble de caractères invalide, vide ou
+// partagé) et sur la liste d'adjacence (serveurs inconnus, boucles, voisins dupliqués, arcs à sens unique et composantes
+// non connexes).
+func Validate(configuration *types.ServerConfig) []Issue {
+	var issues []Issue
+	report := func(severity Severity, format string, args ...any) {
+		issues = append(issues, Issue{Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(configuration.Servers) == 0 {
+		report(Error, "no server is defined")
+		return issues
+	}
+
+	ids := sortedKeys(configuration.Servers)
+
+	// Vérification des serveurs
+
+	addresses := make(map[string]int)
+	charSets := make(map[int]shared.CharSet)
+	for _, id := range ids {
+		server := configuration.Servers[id]
+		if server.Address == "" {
+			report(Error, "P%d has no address", id)
+		} else if other, ok := addresses[server.Address]; ok {
+			report(Error, "P%d and P%d share the address %s", other, id, server.Address)
+		} else {
+			addresses[server.Address] = id
+		}
+
+		characters, err := shared.CharSetOf(server)
+		switch {
+		case err != nil:
+			report(Error, "P%d has an invalid character set: %v", id, err)
+		case characters.IsEmpty():
+			report(Error, "P%d has no character to count", id)
+		default:
+			for _, other := range sortedKeys(charSets) {
+				if common := charSets[other].Intersection(characters); !common.IsEmpty() {
+					report(Warning, "P%d and P%d both count the characters %s", other, id, common)
+				}
+			}
+			charSets[id] = characters
+		}
+	}
+
+	// Vérification de la liste d'adjacence
+
+	edges := make(map[int]map[int]bool)
+	for _, id := range sortedKeys(configuration.AdjacencyList) {
+		if _, ok := configuration.Servers[id]; !ok {
+			report(Error, "adjacency list has an entry for unknown server P%d", id)
+			continue
+		}
+		edges[id] = make(map[int]bool)
+		for _, neighbor := range configuration.AdjacencyList[id] {
+			switch {
+			case neighbor == id:
+				report(Error, "P%d lists itself as a neighbor", id)
+			case !has(configuration.Servers, neighbor):
+				report(Error, "P%d lists unknown server P%d as a neighbor", id, neighbor)
+			case edges[id][neighbor]:
+				report(Warning, "P%d lists P%d as a neighbor more than once", id, neighbor)
+			default:
+				edges[id][neighbor] = true
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if _, ok := configuration.AdjacencyList[id]; !ok && len(ids) > 1 {
+			report(Error, "P%d has no entry in the adjacency list", id)
+		}
+	}
+
+	for _, id := range sortedKeys(edges) {
+		for _, neighbor := range sortedKeys(edges[id]) {
+			if !edges[neighbor][id] {
+				report(Error, "edge P%d -> P%d has no reverse edge P%d -> P%d", id, neighbor, neighbor, id)
+			}
+		}
+	}
+
+	// Vérification des membres initiaux
+
+	members := make(map[int]bool)
+	for _, member := range configuration.Members {
+		switch {
+		case !has(configuration.Servers, member):
+			report(Error, "members list unknown server P%d", member)
+		case members[member]:
+			report(Warning, "P%d is listed as a member more than once", member)
+		default:
+			members[member] = true
+		}
+	}
+
+	if components := connectedComponents(ids, edges); len(components) > 1 {
+		descriptions := make([]string, len(components))
+		for i, component := range components {
+			names := make([]string, len(component))
+			for j, id := range component {
+				names[j] = fmt.Sprintf("P%d", id)
+			}
+			descriptions[i] = "{" + strings.Join(names, ", ") + "}"
+		}
+		report(Error, "network is not connected, it has %d components: %s", len(components), strings.Join(descriptions, " "))
+	}
+
+	return issues
+}
+
+// connectedComponents retourne les composantes connexes du graphe, en considérant chaque arc dans les deux sens.
+func connectedComponents(ids []int, edges map[int]map[int]bool) [][]int {
+	undirected := make(map[int][]int)
+	for id, neighbors := range edges {
+		for neighbor := range neighbors {
+			undirected[id] = append(undirected[id], neighbor)
+			undirected[neighbor] = append(undirected[neighbor], id)
+		}
+	}
+
+	visited := make(map[int]bool)
+	var components [][]int
+	for _, id := range ids {
+		if visited[id] {
+			continue
+		}
+		var component []int
+		queue := []int{id}
+		visited[id] = true
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			component = append(component, current)
+			for _, neighbor := range undirected[current] {
+				if !visited[neighbor] {
+					visited[neighbor] = true
+					queue = append(queue, neighbor)
+				}
+			}
+		}
+		sort.Ints(component)
+		components = append(components, component)
+	}
+	return components
+}
+
+// sortedKeys retourne les clés d'une map triées par ordre croissant.
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// has indique si la map contient la clé spécifiée.
+func has[V any](m map[int]V, key int) bool {
+	_, ok := m[key]
+	return ok
+}
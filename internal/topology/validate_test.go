@@ -0,0 +1,147 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package topology
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// line retourne les serveurs d'un réseau en ligne 0 - 1 - 2 se partageant l'alphabet.
+func line() map[int]types.Server {
+	return map[int]types.Server{
+		0: {Characters: []string{"A-H"}, Address: "localhost:8080"},
+		1: {Characters: []string{"I-P"}, Address: "localhost:8081"},
+		2: {Characters: []string{"Q-Z"}, Address: "localhost:8082"},
+	}
+}
+
+// TestValidate vérifie les problèmes détectés dans des configurations valides et invalides.
+func TestValidate(t *testing.T) {
+	lineAdjacency := map[int][]int{0: {1}, 1: {0, 2}, 2: {1}}
+
+	tests := []struct {
+		name          string
+		configuration types.ServerConfig
+		issues        []Issue
+	}{
+		{
+			name:          "valid line",
+			configuration: types.ServerConfig{Servers: line(), AdjacencyList: lineAdjacency},
+		},
+		{
+			name:          "single server without adjacency",
+			configuration: types.ServerConfig{Servers: map[int]types.Server{0: {Letter: "A", Address: "localhost:8080"}}},
+		},
+		{
+			name:          "no server",
+			configuration: types.ServerConfig{},
+			issues:        []Issue{{Error, "no server is defined"}},
+		},
+		{
+			name: "missing and duplicated addresses",
+			configuration: types.ServerConfig{
+				Servers: map[int]types.Server{
+					0: {Letter: "A", Address: "localhost:8080"},
+					1: {Letter: "B", Address: "localhost:8080"},
+					2: {Letter: "C"},
+				},
+				AdjacencyList: map[int][]int{0: {1}, 1: {0, 2}, 2: {1}},
+			},
+			issues: []Issue{
+				{Error, "P0 and P1 share the address localhost:8080"},
+				{Error, "P2 has no address"},
+			},
+		},
+		{
+			name: "invalid, empty and shared character sets",
+			configuration: types.ServerConfig{
+				Servers: map[int]types.Server{
+					0: {Characters: []string{"A-H"}, Address: "localhost:8080"},
+					1: {Characters: []string{"H-P"}, Address: "localhost:8081"},
+					2: {Address: "localhost:8082"},
+					3: {Characters: []string{"Z-A"}, Address: "localhost:8083"},
+				},
+				AdjacencyList: map[int][]int{0: {1}, 1: {0, 2}, 2: {1, 3}, 3: {2}},
+			},
+			issues: []Issue{
+				{Warning, "P0 and P1 both count the characters H"},
+				{Error, "P2 has no character to count"},
+				{Error, "P3 has an invalid character set: invalid character range \"Z-A\": 'Z' comes after 'A'"},
+			},
+		},
+		{
+			name: "unknown servers, loop and duplicated neighbor",
+			configuration: types.ServerConfig{
+				Servers:       line(),
+				AdjacencyList: map[int][]int{0: {1, 1}, 1: {0, 1, 2, 7}, 2: {1}, 9: {0}},
+			},
+			issues: []Issue{
+				{Warning, "P0 lists P1 as a neighbor more than once"},
+				{Error, "P1 lists itself as a neighbor"},
+				{Error, "P1 lists unknown server P7 as a neighbor"},
+				{Error, "adjacency list has an entry for unknown server P9"},
+			},
+		},
+		{
+			name: "one-way edge",
+			configuration: types.ServerConfig{
+				Servers:       line(),
+				AdjacencyList: map[int][]int{0: {1, 2}, 1: {0, 2}, 2: {1}},
+			},
+			issues: []Issue{{Error, "edge P0 -> P2 has no reverse edge P2 -> P0"}},
+		},
+		{
+			name: "missing entry and disconnected network",
+			configuration: types.ServerConfig{
+				Servers:       line(),
+				AdjacencyList: map[int][]int{0: {1}, 1: {0}},
+			},
+			issues: []Issue{
+				{Error, "P2 has no entry in the adjacency list"},
+				{Error, "network is not connected, it has 2 components: {P0, P1} {P2}"},
+			},
+		},
+		{
+			name: "invalid members",
+			configuration: types.ServerConfig{
+				Servers:       line(),
+				AdjacencyList: lineAdjacency,
+				Members:       []int{0, 1, 1, 5},
+			},
+			issues: []Issue{
+				{Warning, "P1 is listed as a member more than once"},
+				{Error, "members list unknown server P5"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issues := Validate(&test.configuration)
+			if !reflect.DeepEqual(issues, test.issues) {
+				t.Fatalf("issues:\n%v\nwant:\n%v", issues, test.issues)
+			}
+		})
+	}
+}
+
+// TestCheck vérifie que seuls les problèmes de gravité Error refusent la configuration.
+func TestCheck(t *testing.T) {
+	servers := line()
+	servers[1] = types.Server{Characters: []string{"H-P"}, Address: "localhost:8081"}
+	warnings, err := Check(&types.ServerConfig{Servers: servers, AdjacencyList: map[int][]int{0: {1}, 1: {0, 2}, 2: {1}}})
+	if err != nil || len(warnings) != 1 {
+		t.Fatalf("warnings %v and error %v, want a single warning", warnings, err)
+	}
+
+	_, err = Check(&types.ServerConfig{Servers: line(), AdjacencyList: map[int][]int{0: {1}, 1: {0}}})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Issues) != 2 {
+		t.Fatalf("error %v, want a validation error with two issues", err)
+	}
+}
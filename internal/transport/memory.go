@@ -0,0 +1,105 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package transport
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+const memoryQueueSize = 1024 // Nombre de messages en attente de lecture au-delà duquel un transport en mémoire perd les messages reçus
+
+// MemoryNetwork est un réseau en mémoire reliant des transports d'un même programme par des channels, sans socket.
+// Comme en UDP, un message envoyé à un transport dont la file de réception est pleine est perdu.
+type MemoryNetwork struct {
+	mutex      sync.Mutex
+	transports map[string]*memoryTransport // Transports à l'écoute, la clé est leur adresse
+	next       int                         // Compteur utilisé pour attribuer une adresse aux transports sans adresse
+}
+
+// memoryTransport est un transport du réseau en mémoire.
+type memoryTransport struct {
+	network *MemoryNetwork
+	address string
+	mutex   sync.Mutex // Mutex protégeant l'envoi sur le channel des messages et sa fermeture
+	packets chan Packet
+	closed  bool
+}
+
+// NewMemoryNetwork crée un réseau en mémoire vide.
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{transports: make(map[string]*memoryTransport)}
+}
+
+// Listen crée un transport du réseau à l'adresse spécifiée. Les adresses ne sont que des noms et n'ont pas besoin
+// d'être valides. Une adresse vide attribue au transport une adresse unique.
+func (n *MemoryNetwork) Listen(address string) (Transport, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if address == "" {
+		n.next++
+		address = "memory-" + strconv.Itoa(n.next)
+	}
+	if _, ok := n.transports[address]; ok {
+		return nil, fmt.Errorf("address %s already in use", address)
+	}
+
+	t := &memoryTransport{
+		network: n,
+		address: address,
+		packets: make(chan Packet, memoryQueueSize),
+	}
+	n.transports[address] = t
+	return t, nil
+}
+
+// Send dépose une copie du message dans la file de réception du transport à l'adresse spécifiée.
+func (t *memoryTransport) Send(address string, data []byte) error {
+	t.network.mutex.Lock()
+	destination, ok := t.network.transports[address]
+	t.network.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("no transport listening on %s", address)
+	}
+
+	destination.mutex.Lock()
+	defer destination.mutex.Unlock()
+	if destination.closed {
+		return fmt.Errorf("no transport listening on %s", address)
+	}
+	select {
+	case destination.packets <- Packet{From: t.address, Remote: t.address, Data: append([]byte{}, data...)}:
+	default:
+	}
+	return nil
+}
+
+// Receive retourne le channel des messages reçus.
+func (t *memoryTransport) Receive() <-chan Packet {
+	return t.packets
+}
+
+// Address retourne l'adresse du transport dans le réseau.
+func (t *memoryTransport) Address() string {
+	return t.address
+}
+
+// Close retire le transport du réseau et ferme le channel des messages.
+func (t *memoryTransport) Close() error {
+	t.network.mutex.Lock()
+	if t.network.transports[t.address] == t {
+		delete(t.network.transports, t.address)
+	}
+	t.network.mutex.Unlock()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.packets)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+const dialTimeout = 5 * time.Second // Délai maximal d'établissement d'une connexion TCP
+
+// TCP est le réseau des transports TCP. Chaque message est envoyé dans une trame préfixée par sa taille sur 4 octets.
+// Les connexions sont gardées ouvertes et réutilisées dans les deux sens. La première trame d'une connexion contient
+// l'adresse d'écoute de celui qui l'a ouverte, afin que ses messages soient reçus avec cette adresse comme émetteur.
+// Cette adresse est choisie par le pair, l'adresse distante de la connexion est donc aussi transmise avec chaque message.
+type TCP struct {
+	Options Options // Limites appliquées aux messages
+}
+
+// tcpTransport est un transport TCP, avec ou sans écoute de connexions entrantes.
+type tcpTransport struct {
+	options  Options
+	listener net.Listener        // Socket d'écoute, nil pour un transport sans écoute
+	mutex    sync.Mutex          // Mutex protégeant les connexions
+	conns    map[string]*tcpConn // Connexions utilisées pour les envois, la clé est l'adresse du pair
+	all      map[*tcpConn]bool   // Toutes les connexions ouvertes, fermées à l'arrêt du transport
+	packets  chan Packet
+	closed   chan struct{}
+	readers  sync.WaitGroup // Goroutines de lecture en cours
+}
+
+// tcpConn est une connexion TCP dont les écritures sont sérialisées.
+type tcpConn struct {
+	net.Conn
+	writeMutex sync.Mutex
+}
+
+// Listen crée un transport TCP écoutant à l'adresse spécifiée. Avec une adresse vide, le transport n'accepte pas de
+// connexion et ne reçoit que les réponses arrivant sur les connexions qu'il a ouvertes.
+func (t TCP) Listen(address string) (Transport, error) {
+	transport := &tcpTransport{
+		options: t.Options,
+		conns:   make(map[string]*tcpConn),
+		all:     make(map[*tcpConn]bool),
+		packets: make(chan Packet, 64),
+		closed:  make(chan struct{}),
+	}
+
+	if address != "" {
+		listener, err := net.Listen("tcp4", address)
+		if err != nil {
+			return nil, err
+		}
+		transport.listener = listener
+		transport.readers.Add(1)
+		go transport.accept()
+	}
+
+	go func() {
+		<-transport.closed
+		transport.readers.Wait()
+		close(transport.packets)
+	}()
+	return transport, nil
+}
+
+// Send envoie le message sur la connexion ouverte avec l'adresse spécifiée, et l'ouvre si nécessaire.
+func (t *tcpTransport) Send(address string, data []byte) error {
+	if len(data) > t.maxMessageSize() {
+		return fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", len(data), t.maxMessageSize())
+	}
+
+	conn, err := t.connection(address)
+	if err != nil {
+		return err
+	}
+
+	conn.writeMutex.Lock()
+	err = writeFrame(conn, data)
+	conn.writeMutex.Unlock()
+	if err != nil {
+		t.forget(address, conn)
+	}
+	return err
+}
+
+// Receive retourne le channel des messages reçus sur toutes les connexions.
+func (t *tcpTransport) Receive() <-chan Packet {
+	return t.packets
+}
+
+// Address retourne l'adresse d'écoute du transport, vide s'il n'écoute pas.
+func (t *tcpTransport) Address() string {
+	if t.listener == nil {
+		return ""
+	}
+	return t.listener.Addr().String()
+}
+
+// Close ferme le socket d'écoute et toutes les connexions ouvertes.
+func (t *tcpTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	select {
+	case <-t.closed:
+		return nil
+	default:
+	}
+	close(t.closed)
+
+	var err error
+	if t.listener != nil {
+		err = t.listener.Close()
+	}
+	for conn := range t.all {
+		conn.Close()
+	}
+	return err
+}
+
+// connection retourne la connexion ouverte avec l'adresse spécifiée ou en ouvre une nouvelle.
+func (t *tcpTransport) connection(address string) (*tcpConn, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	select {
+	case <-t.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+
+	if conn, ok := t.conns[address]; ok {
+		return conn, nil
+	}
+
+	netConn, err := net.DialTimeout("tcp4", address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &tcpConn{Conn: netConn}
+	if err := writeFrame(conn, []byte(t.Address())); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t.conns[address] = conn
+	t.all[conn] = true
+	t.readers.Add(1)
+	go t.read(conn, address)
+	return conn, nil
+}
+
+// accept accepte les connexions entrantes jusqu'à la fermeture du socket d'écoute.
+func (t *tcpTransport) accept() {
+	defer t.readers.Done()
+
+	for {
+		netConn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		conn := &tcpConn{Conn: netConn}
+		t.mutex.Lock()
+		select {
+		case <-t.closed:
+			conn.Close()
+		default:
+			t.all[conn] = true
+			t.readers.Add(1)
+			go t.handshake(conn)
+		}
+		t.mutex.Unlock()
+	}
+}
+
+// handshake lit l'adresse annoncée par le pair d'une connexion entrante puis lit ses messages.
+// Un pair sans adresse d'écoute est identifié par l'adresse distante de la connexion.
+func (t *tcpTransport) handshake(conn *tcpConn) {
+	hello, err := readFrame(conn, t.maxMessageSize())
+	if err != nil {
+		t.forget("", conn)
+		t.readers.Done()
+		return
+	}
+
+	address := string(hello)
+	if address == "" {
+		address = conn.RemoteAddr().String()
+	}
+
+	t.mutex.Lock()
+	if _, ok := t.conns[address]; !ok {
+		t.conns[address] = conn
+	}
+	t.mutex.Unlock()
+
+	t.read(conn, address)
+}
+
+// read livre les messages reçus sur une connexion jusqu'à sa fermeture.
+func (t *tcpTransport) read(conn *tcpConn, address string) {
+	defer t.readers.Done()
+	defer t.forget(address, conn)
+
+	for {
+		data, err := readFrame(conn, t.maxMessageSize())
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				shared.Log(types.ERROR, err.Error()+" from "+address)
+			}
+			return
+		}
+		select {
+		case t.packets <- Packet{From: address, Remote: conn.RemoteAddr().String(), Data: data}:
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// forget ferme une connexion et la retire des connexions ouvertes.
+func (t *tcpTransport) forget(address string, conn *tcpConn) {
+	conn.Close()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.conns[address] == conn {
+		delete(t.conns, address)
+	}
+	delete(t.all, conn)
+}
+
+// maxMessageSize retourne la taille maximale d'un message, avec la valeur par défaut si elle n'est pas configurée.
+func (t *tcpTransport) maxMessageSize() int {
+	if t.options.MaxMessageSize <= 0 {
+		return shared.DefaultMaxMessageSize
+	}
+	return t.options.MaxMessageSize
+}
+
+// writeFrame écrit une trame composée de la taille du message sur 4 octets suivie du message.
+func writeFrame(conn net.Conn, data []byte) error {
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err := conn.Write(frame)
+	return err
+}
+
+// readFrame lit une trame et refuse les messages plus grands que la taille maximale.
+func readFrame(conn net.Conn, maxMessageSize int) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size > uint32(maxMessageSize) {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit of %d bytes", size, maxMessageSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
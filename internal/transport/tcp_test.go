@@ -0,0 +1,44 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestTCPRemoteAddress vérifie qu'un message reçu en TCP porte l'adresse distante réelle de la connexion, et non
+// seulement l'adresse annoncée par le pair.
+func TestTCPRemoteAddress(t *testing.T) {
+	receiver, err := TCP{}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	conn, err := net.Dial("tcp4", receiver.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := writeFrame(conn, []byte("10.0.0.5:8080")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(conn, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case packet := <-receiver.Receive():
+		if packet.From != "10.0.0.5:8080" {
+			t.Errorf("from %s, want the announced address", packet.From)
+		}
+		if packet.Remote != conn.LocalAddr().String() {
+			t.Errorf("remote %s, want %s", packet.Remote, conn.LocalAddr())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
@@ -0,0 +1,63 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+// Package transport propose une abstraction des échanges de messages entre serveurs et clients.
+// Un transport envoie des messages complets à une adresse et livre les messages reçus sur un channel.
+// Le package fournit un transport UDP avec fragmentation des messages, un transport TCP avec des messages préfixés par leur
+// taille et un transport en mémoire permettant de faire communiquer des serveurs d'un même programme sans socket.
+package transport
+
+import (
+	"fmt"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+)
+
+// Packet représente un message complet reçu par un transport.
+type Packet struct {
+	From   string // Adresse de l'émetteur, utilisable pour lui répondre avec Send
+	Remote string // Adresse d'où provient réellement le message, à utiliser pour identifier l'émetteur
+	Data   []byte // Contenu du message
+}
+
+// Transport représente un point de communication capable d'envoyer des messages à d'autres transports et d'en recevoir.
+type Transport interface {
+	Send(address string, data []byte) error // Envoie un message complet à l'adresse spécifiée
+	Receive() <-chan Packet                 // Retourne le channel des messages reçus, fermé à l'arrêt du transport
+	Address() string                        // Retourne l'adresse d'écoute du transport
+	Close() error                           // Arrête le transport
+}
+
+// Network permet de créer des transports d'un même type.
+type Network interface {
+	// Listen crée un transport écoutant à l'adresse spécifiée. Une adresse vide crée un transport sur une adresse
+	// choisie par le système, utile pour un client qui attend seulement des réponses.
+	Listen(address string) (Transport, error)
+}
+
+// Options regroupe les limites appliquées aux messages par les transports.
+type Options struct {
+	FragmentSize   int // Taille maximale en octets des données d'un fragment, utilisée par le transport UDP
+	MaxMessageSize int // Taille maximale en octets d'un message
+}
+
+const (
+	KindUDP = "udp" // Type de transport UDP, utilisé par défaut
+	KindTCP = "tcp" // Type de transport TCP
+)
+
+// New retourne le réseau correspondant au type de transport spécifié dans une configuration.
+// Un type vide correspond au transport UDP, pour lequel la taille des fragments doit tenir dans un datagramme.
+func New(kind string, options Options) (Network, error) {
+	switch kind {
+	case "", KindUDP:
+		if err := shared.CheckFragmentSize(options.FragmentSize, options.MaxMessageSize); err != nil {
+			return nil, err
+		}
+		return UDP{Options: options}, nil
+	case KindTCP:
+		return TCP{Options: options}, nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", kind)
+	}
+}
@@ -0,0 +1,109 @@
+// Auteurs: Jonathan Friedli, Lazar Pavicevic
+// Labo 4 SDR
+
+package transport
+
+import (
+	"errors"
+	"net"
+
+	"github.com/Lazzzer/labo4-sdr/internal/shared"
+	"github.com/Lazzzer/labo4-sdr/internal/shared/types"
+)
+
+// UDP est le réseau des transports UDP. Les messages sont découpés en fragments envoyés chacun dans un datagramme
+// et réassemblés à la réception. Les envois partent du socket d'écoute, l'adresse de l'émetteur est donc son adresse d'écoute.
+type UDP struct {
+	Options Options // Limites appliquées aux messages
+}
+
+// udpTransport est un transport UDP écoutant sur un socket.
+type udpTransport struct {
+	options     Options
+	connection  *net.UDPConn
+	reassembler *shared.Reassembler
+	packets     chan Packet
+}
+
+// Listen crée un transport UDP écoutant à l'adresse spécifiée.
+func (u UDP) Listen(address string) (Transport, error) {
+	if address == "" {
+		address = ":0"
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := net.ListenUDP("udp4", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &udpTransport{
+		options:     u.Options,
+		connection:  connection,
+		reassembler: shared.NewReassembler(u.Options.FragmentSize, u.Options.MaxMessageSize),
+		packets:     make(chan Packet, 64),
+	}
+	go t.receive()
+	return t, nil
+}
+
+// Send découpe le message en fragments et les envoie à l'adresse spécifiée.
+func (t *udpTransport) Send(address string, data []byte) error {
+	frames, err := shared.Split(data, t.options.FragmentSize, t.options.MaxMessageSize)
+	if err != nil {
+		return err
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return err
+	}
+	for _, frame := range frames {
+		if _, err := t.connection.WriteToUDP(frame, udpAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Receive retourne le channel des messages réassemblés.
+func (t *udpTransport) Receive() <-chan Packet {
+	return t.packets
+}
+
+// Address retourne l'adresse d'écoute du socket.
+func (t *udpTransport) Address() string {
+	return t.connection.LocalAddr().String()
+}
+
+// Close ferme le socket, ce qui termine la réception et ferme le channel des messages.
+func (t *udpTransport) Close() error {
+	return t.connection.Close()
+}
+
+// receive lit les datagrammes reçus et livre chaque message une fois tous ses fragments reçus.
+func (t *udpTransport) receive() {
+	defer close(t.packets)
+
+	buffer := make([]byte, shared.MaxDatagramSize)
+	for {
+		n, addr, err := t.connection.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			shared.Log(types.ERROR, err.Error())
+			continue
+		}
+
+		message, complete, err := t.reassembler.Add(buffer[0:n])
+		if err != nil {
+			shared.Log(types.ERROR, err.Error()+" from "+addr.String())
+			continue
+		}
+		if complete {
+			t.packets <- Packet{From: addr.String(), Remote: addr.String(), Data: message}
+		}
+	}
+}